@@ -0,0 +1,379 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ------------------- ar
+
+// ar(1) archives are a global header followed by members, each with a fixed
+// 60 bytes header, the data being aligned on 2 bytes.  Names longer than 16
+// bytes are in a "//" member for GNU ar ("/offset" in the header) or just
+// after the header for BSD ar ("#1/length").
+
+var magicAr = []byte("!<arch>\n")
+
+const (
+	arHeaderLen = 60
+	arNameLen   = 16
+	// These are read in memory, real ones are much smaller
+	arMaxNames   = 64 << 10
+	arMaxNameLen = 4 << 10
+)
+
+var errArHeader = errors.New("invalid ar header")
+
+// arHeader is one member
+type arHeader struct {
+	Name    string
+	ModTime time.Time
+	Mode    os.FileMode
+	Size    int64
+}
+
+// arReader reads members sequentially like tar.Reader
+type arReader struct {
+	r     io.Reader
+	names []byte // GNU long names
+	nb    int64  // what is left of the current member
+	pad   int64
+}
+
+// newArReader checks the global header
+func newArReader(r io.Reader) (*arReader, error) {
+	magic := make([]byte, len(magicAr))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return nil, errors.Wrap(err, "header")
+	}
+	if !bytes.Equal(magic, magicAr) {
+		return nil, errors.New("not an ar archive")
+	}
+	return &arReader{r: r}, nil
+}
+
+// arField returns a header field without the padding
+func arField(b []byte) string {
+	return strings.TrimRight(string(b), " ")
+}
+
+// arNumber parses a header field, empty ones are 0
+func arNumber(b []byte, base int) (int64, error) {
+	s := arField(b)
+	if s == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(s, base, 64)
+}
+
+// Next skips what is left of the current member and reads the next header,
+// the symbol tables and the GNU name table are skipped too.
+func (ar *arReader) Next() (*arHeader, error) {
+	for {
+		if _, err := io.CopyN(ioutil.Discard, ar.r, ar.nb+ar.pad); err != nil {
+			return nil, err
+		}
+		ar.nb, ar.pad = 0, 0
+
+		buf := make([]byte, arHeaderLen)
+		if _, err := io.ReadFull(ar.r, buf); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = errArHeader
+			}
+			return nil, err
+		}
+		if buf[58] != '`' || buf[59] != '\n' {
+			return nil, errArHeader
+		}
+
+		mtime, err1 := arNumber(buf[16:28], 10)
+		mode, err2 := arNumber(buf[40:48], 8)
+		size, err3 := arNumber(buf[48:58], 10)
+		if err1 != nil || err2 != nil || err3 != nil || size < 0 {
+			return nil, errArHeader
+		}
+		ar.nb, ar.pad = size, size%2
+
+		hdr := &arHeader{
+			Name:    arField(buf[:arNameLen]),
+			ModTime: time.Unix(mtime, 0),
+			Mode:    os.FileMode(mode).Perm(),
+			Size:    size,
+		}
+
+		switch {
+		case hdr.Name == "/" || hdr.Name == "/SYM64/" || strings.HasPrefix(hdr.Name, "__.SYMDEF"):
+			// Symbol tables
+			continue
+		case hdr.Name == "//":
+			if size > arMaxNames {
+				return nil, errArHeader
+			}
+			names := make([]byte, size)
+			if _, err := io.ReadFull(ar.r, names); err != nil {
+				return nil, errArHeader
+			}
+			ar.names, ar.nb = names, 0
+			continue
+		case strings.HasPrefix(hdr.Name, "#1/"):
+			n, err := strconv.ParseInt(hdr.Name[3:], 10, 64)
+			if err != nil || n < 0 || n > size || n > arMaxNameLen {
+				return nil, errArHeader
+			}
+			name := make([]byte, n)
+			if _, err := io.ReadFull(ar.r, name); err != nil {
+				return nil, errArHeader
+			}
+			hdr.Name = string(bytes.TrimRight(name, "\x00"))
+			hdr.Size -= n
+			ar.nb = hdr.Size
+		case strings.HasPrefix(hdr.Name, "/"):
+			off, err := strconv.Atoi(hdr.Name[1:])
+			if err != nil || off < 0 || off >= len(ar.names) {
+				return nil, errArHeader
+			}
+			name := ar.names[off:]
+			if i := bytes.IndexByte(name, '\n'); i >= 0 {
+				name = name[:i]
+			}
+			hdr.Name = strings.TrimSuffix(string(name), "/")
+		default:
+			// GNU ar ends names with '/' to allow spaces
+			hdr.Name = strings.TrimSuffix(hdr.Name, "/")
+		}
+		return hdr, nil
+	}
+}
+
+// Read reads from the current member
+func (ar *arReader) Read(p []byte) (int, error) {
+	if ar.nb == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > ar.nb {
+		p = p[:ar.nb]
+	}
+	n, err := ar.r.Read(p)
+	ar.nb -= int64(n)
+	if err == io.EOF && ar.nb > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Ar is for ar archives like static libraries or the outer part of Debian
+// packages.  There is no directory, only files.  Like Tar it is read
+// sequentially.
+type Ar struct {
+	fn  string
+	afh *arReader
+	fh  io.Closer
+	lim Limits
+	log Logger
+}
+
+// NewArfile opens an ar file
+func NewArfile(fn string, opts ...Option) (*Ar, error) {
+	o := newOptions(opts)
+
+	fh, err := os.Open(fn)
+	if err != nil {
+		return &Ar{}, errors.Wrap(err, "NewArfile")
+	}
+
+	afh, err := newArReader(fh)
+	if err != nil {
+		fh.Close()
+		return &Ar{}, errors.Wrap(err, "ar")
+	}
+	return &Ar{fn: fn, afh: afh, fh: fh, lim: o.lim, log: o.log}, nil
+}
+
+// NewArFromReader reads the archive from r
+func NewArFromReader(r io.Reader, opts ...Option) (*Ar, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	o := newOptions(opts)
+
+	afh, err := newArReader(r)
+	if err != nil {
+		return &Ar{}, errors.Wrap(err, "ar")
+	}
+	return &Ar{fn: "-", afh: afh, lim: o.lim, log: o.log}, nil
+}
+
+// next reads the next header, with io.EOF at the end
+func (a Ar) next() (*arHeader, error) {
+	hdr, err := a.afh.Next()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read")
+	}
+
+	debug(a.log, "found", Field{"archive", a.fn}, Field{"member", hdr.Name})
+	return hdr, nil
+}
+
+// Extract returns the content of the first member whose name ends with t
+func (a Ar) Extract(t string) ([]byte, error) {
+	g := newGuard(a.lim, nil)
+	for {
+		hdr, err := a.next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return []byte{}, err
+		}
+
+		if err := g.add(hdr.Name, 1); err != nil {
+			return []byte{}, err
+		}
+
+		if strings.HasSuffix(hdr.Name, t) {
+			var buf bytes.Buffer
+
+			n, err := io.Copy(&buf, g.reader(hdr.Name, a.afh, hdr.Size))
+			if err != nil {
+				return []byte{}, errors.Wrap(err, "copy")
+			}
+			debug(a.log, "read", Field{"archive", a.fn}, Field{"member", hdr.Name}, Field{"bytes", n})
+			return buf.Bytes(), nil
+		}
+	}
+	return nil, notFound(a.fn, t)
+}
+
+// ExtractAll returns every member matching t in archive order, an empty t
+// matches all of them.
+func (a Ar) ExtractAll(t string) ([]Member, error) {
+	var all []Member
+
+	g := newGuard(a.lim, nil)
+	for {
+		hdr, err := a.next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return all, err
+		}
+
+		if err := g.add(hdr.Name, 1); err != nil {
+			return all, err
+		}
+
+		if !strings.HasSuffix(hdr.Name, t) {
+			continue
+		}
+
+		var buf bytes.Buffer
+
+		n, err := io.Copy(&buf, g.reader(hdr.Name, a.afh, hdr.Size))
+		if err != nil {
+			return all, errors.Wrapf(err, "copy %s", hdr.Name)
+		}
+		debug(a.log, "read", Field{"archive", a.fn}, Field{"member", hdr.Name}, Field{"bytes", n})
+		all = append(all, Member{Name: hdr.Name, Data: buf.Bytes()})
+	}
+
+	if len(all) == 0 {
+		return all, notFound(a.fn, t)
+	}
+	return all, nil
+}
+
+// Close closes the file
+func (a Ar) Close() error {
+	if a.fh != nil {
+		return a.fh.Close()
+	}
+	return nil
+}
+
+// Type returns the archive type obviously.
+func (a Ar) Type() int {
+	return ArchiveAr
+}
+
+// arInfo fills an EntryInfo from a member header, nothing is compressed
+func arInfo(hdr *arHeader) EntryInfo {
+	return EntryInfo{
+		Name:           hdr.Name,
+		Size:           hdr.Size,
+		CompressedSize: hdr.Size,
+		ModTime:        hdr.ModTime,
+		Mode:           hdr.Mode,
+		Type:           EntryFile,
+	}
+}
+
+// List reads all headers.  Like Tar it can not be used afterwards.
+func (a Ar) List() ([]EntryInfo, error) {
+	var list []EntryInfo
+
+	for {
+		hdr, err := a.next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return list, err
+		}
+		list = append(list, arInfo(hdr))
+	}
+	return list, nil
+}
+
+type arWalker struct {
+	a Ar
+	g *guard
+}
+
+// Walk returns a walker going through the archive
+func (a Ar) Walk() (Walker, error) {
+	return &arWalker{a: a, g: newGuard(a.lim, nil)}, nil
+}
+
+// Next reads the next header
+func (w *arWalker) Next() (*Entry, error) {
+	hdr, err := w.a.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.g.add(hdr.Name, 1); err != nil {
+		return nil, err
+	}
+	return &Entry{EntryInfo: arInfo(hdr), r: w.g.reader(hdr.Name, w.a.afh, hdr.Size)}, nil
+}
+
+// ExtractTo writes every member under dir and returns the list of paths
+// created.  Names with ".." and absolute ones are rejected.
+func (a Ar) ExtractTo(dir string, opts ExtractOptions) ([]string, error) {
+	w, err := a.Walk()
+	if err != nil {
+		return nil, err
+	}
+	return extractTo(a.log, w, dir, opts)
+}
+
+// SetLimits changes the limits for this archive
+func (a *Ar) SetLimits(l Limits) {
+	a.lim = l
+}
+
+// SetLogger changes the logger for this archive
+func (a *Ar) SetLogger(l Logger) {
+	a.log = l
+}
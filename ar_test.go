@@ -0,0 +1,194 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mkArBSD builds an archive like BSD ar does, names being after the header
+func mkArBSD(files ...member) []byte {
+	buf := bytes.NewBufferString("!<arch>\n")
+	for _, f := range files {
+		name := fmt.Sprintf("#1/%d", len(f.name))
+		fmt.Fprintf(buf, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, 1528977600, 0, 0, 0644, len(f.name)+len(f.data))
+		buf.WriteString(f.name)
+		buf.Write(f.data)
+		if (len(f.name)+len(f.data))%2 == 1 {
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestNewArfile(t *testing.T) {
+	a, err := New("testdata/notempty.a")
+	require.NoError(t, err)
+	require.IsType(t, (*Ar)(nil), a)
+	defer a.Close()
+
+	assert.Equal(t, ArchiveAr, a.Type())
+	assert.Implements(t, (*MultiExtracter)(nil), a)
+	assert.Implements(t, (*Lister)(nil), a)
+	assert.Implements(t, (*Walkable)(nil), a)
+	assert.Implements(t, (*DirExtracter)(nil), a)
+	assert.Implements(t, (*Limiter)(nil), a)
+	assert.Implements(t, (*Loggable)(nil), a)
+}
+
+func TestNewArfile_Bad(t *testing.T) {
+	_, err := NewArfile("/nonexistent")
+	assert.Error(t, err)
+
+	_, err = NewArfile("testdata/notempty.txt")
+	assert.Error(t, err)
+
+	_, err = NewArFromReader(nil)
+	assert.True(t, errors.Is(err, ErrNilReader))
+}
+
+func TestAr_Extract(t *testing.T) {
+	a, err := NewArfile("testdata/notempty.a")
+	require.NoError(t, err)
+	defer a.Close()
+
+	o, err := a.Extract("name.o")
+	require.NoError(t, err)
+	assert.Equal(t, "int main;\n", string(o))
+
+	txt, err := a.Extract(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+
+	_, err = a.Extract(".json")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestAr_ExtractAll(t *testing.T) {
+	a, err := NewArfile("testdata/notempty.a")
+	require.NoError(t, err)
+	defer a.Close()
+
+	all, err := a.ExtractAll(".o")
+	require.NoError(t, err)
+	assert.Equal(t, []Member{
+		{Name: "short.o", Data: []byte("odd\n")},
+		{Name: "a-rather-long-member-name.o", Data: []byte("int main;\n")},
+	}, all)
+}
+
+func TestAr_BSD(t *testing.T) {
+	file := mkArBSD(
+		member{"a-rather-long-member-name.o", []byte("int main;\n")},
+		member{"odd.txt", []byte("odd")},
+		member{"even.txt", []byte("even")},
+	)
+
+	a, err := NewFromReader(bytes.NewReader(file), 0)
+	require.NoError(t, err)
+	require.IsType(t, (*Ar)(nil), a)
+
+	all, err := a.(MultiExtracter).ExtractAll("")
+	require.NoError(t, err)
+	assert.Equal(t, []Member{
+		{Name: "a-rather-long-member-name.o", Data: []byte("int main;\n")},
+		{Name: "odd.txt", Data: []byte("odd")},
+		{Name: "even.txt", Data: []byte("even")},
+	}, all)
+}
+
+func TestAr_Truncated(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.a")
+	require.NoError(t, err)
+
+	a, err := NewArFromReader(bytes.NewReader(file[:len(file)-10]))
+	require.NoError(t, err)
+
+	_, err = a.ExtractAll("")
+	assert.Error(t, err)
+}
+
+func TestAr_HugeNames(t *testing.T) {
+	for _, name := range []string{"//", "#1/5000", "#1/99999999"} {
+		file := []byte("!<arch>\n" + fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, 0, 0, 0, 0644, int64(9999999999)))
+		require.Len(t, file, 68)
+
+		a, err := NewArFromReader(bytes.NewReader(file))
+		require.NoError(t, err)
+
+		_, err = a.ExtractAll("")
+		assert.Error(t, err, name)
+
+		_, err = NewDebFromReader(bytes.NewReader(file))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestAr_List(t *testing.T) {
+	a, err := NewArfile("testdata/notempty.a")
+	require.NoError(t, err)
+	defer a.Close()
+
+	list, err := a.List()
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+
+	assert.Equal(t, "notempty.txt", list[2].Name)
+	assert.Equal(t, int64(15), list[2].Size)
+	assert.Equal(t, os.FileMode(0644), list[2].Mode)
+	assert.Equal(t, EntryFile, list[2].Type)
+}
+
+func TestAr_Walk(t *testing.T) {
+	a, err := NewArfile("testdata/notempty.a")
+	require.NoError(t, err)
+	defer a.Close()
+
+	w, err := a.Walk()
+	require.NoError(t, err)
+
+	var names []string
+	for {
+		e, err := w.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{"short.o", "a-rather-long-member-name.o", "notempty.txt"}, names)
+}
+
+func TestAr_ExtractTo(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	a, err := NewArfile("testdata/notempty.a")
+	require.NoError(t, err)
+	defer a.Close()
+
+	files, err := a.ExtractTo(dir, ExtractOptions{})
+	require.NoError(t, err)
+	assert.Len(t, files, 3)
+
+	txt, err := ioutil.ReadFile(filepath.Join(dir, "notempty.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+}
+
+func TestAr_Limits(t *testing.T) {
+	a, err := New("testdata/notempty.a", WithLimits(Limits{MaxEntrySize: 4}))
+	require.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.Extract(".txt")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
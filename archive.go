@@ -3,9 +3,13 @@ package archive
 import (
 	"archive/tar"
 	"archive/zip"
+	"bufio"
 	"bytes"
+	"compress/bzip2"
+	"compress/flate"
 	"compress/gzip"
-	"fmt"
+	"compress/zlib"
+	"encoding/binary"
 	"io"
 	"io/ioutil"
 	"os"
@@ -13,8 +17,13 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/s2"
 	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
 	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
 )
 
 // Version number (SemVer)
@@ -22,11 +31,6 @@ const (
 	myVersion = "0.9.1"
 )
 
-var (
-	fVerbose = false
-	fDebug   = false
-)
-
 // ------------------- Interfaces
 
 // Extracter is the main interface we have
@@ -41,6 +45,17 @@ type ExtractCloser interface {
 	Type() int
 }
 
+// MultiExtracter is for archives with more than one file inside
+type MultiExtracter interface {
+	ExtractAll(t string) ([]Member, error)
+}
+
+// Member is one file extracted from an archive
+type Member struct {
+	Name string
+	Data []byte
+}
+
 const (
 	// ArchivePlain starts the different types
 	ArchivePlain = 1 << iota
@@ -54,6 +69,39 @@ const (
 	ArchiveGpg
 	// ArchiveZstd is for Zstd archives
 	ArchiveZstd
+	// ArchiveBzip2 is for bzip2 files
+	ArchiveBzip2
+	// ArchiveXz is for xz files
+	ArchiveXz
+	// ArchiveLzma is for raw lzma files (lzma_alone)
+	ArchiveLzma
+	// ArchiveLz4 is for lz4 frames
+	ArchiveLz4
+	// ArchiveSnappy is for snappy framed streams
+	ArchiveSnappy
+	// ArchiveBrotli is for brotli files, only known by their extension
+	ArchiveBrotli
+	// ArchiveCompress is for Unix compress (.Z) files
+	ArchiveCompress
+	// ArchiveZlib is for zlib streams, what HTTP calls "deflate"
+	ArchiveZlib
+	// ArchiveDeflate is for raw deflate streams, only known by their extension
+	ArchiveDeflate
+	// ArchiveSevenZip is for 7z archives
+	ArchiveSevenZip
+	// ArchiveRar is for RAR archives
+	ArchiveRar
+	// ArchiveCpio is for cpio archives (newc), compressed ones have the
+	// compression bit set too
+	ArchiveCpio
+	// ArchiveAr is for ar archives (static libraries, etc.)
+	ArchiveAr
+	// ArchiveDeb is for Debian packages
+	ArchiveDeb
+	// ArchiveRpm is for RPM packages
+	ArchiveRpm
+	// ArchiveIso is for ISO 9660 images
+	ArchiveIso
 )
 
 // ------------------- Plain
@@ -62,14 +110,18 @@ const (
 type Plain struct {
 	Name string
 	r    io.Reader
+	log  Logger
 }
 
-func NewPlainfile(fn string) (*Plain, error) {
+// NewPlainfile opens fn, only WithLogger() is used
+func NewPlainfile(fn string, opts ...Option) (*Plain, error) {
+	o := newOptions(opts)
+
 	fh, err := os.Open(fn)
 	if err != nil {
 		return nil, errors.Wrap(err, "NewPlainfile")
 	}
-	return &Plain{Name: fn, r: fh}, nil
+	return &Plain{Name: fn, r: fh, log: o.log}, nil
 }
 
 // Extract returns the content of the file
@@ -87,7 +139,7 @@ func (a Plain) Extract(t string) ([]byte, error) {
 	if ext == t || t == "" {
 		return ioutil.ReadFile(a.Name)
 	}
-	return []byte{}, fmt.Errorf("wrong file type")
+	return []byte{}, &ArchiveError{Op: "extract", Archive: a.Name, Err: ErrWrongType}
 }
 
 // Close is a no-op
@@ -105,41 +157,204 @@ func (a Plain) Type() int {
 // Zip is for pkzip/infozip files
 type Zip struct {
 	fn  string
-	zfh *zip.ReadCloser
+	zfh *zip.Reader
+	fh  io.Closer
+	tmp string
+	in  *counter
+	lim Limits
+	log Logger
 }
 
+// DefaultMemoryLimit is the size above which a zip, 7z or ISO image read
+// from a stream is written into a temporary file instead of being kept in
+// memory, see WithMemoryLimit.
+const DefaultMemoryLimit = 32 << 20
+
 // NewZipfile open the zip file
-func NewZipfile(fn string) (*Zip, error) {
-	zfh, err := zip.OpenReader(fn)
+func NewZipfile(fn string, opts ...Option) (*Zip, error) {
+	o := newOptions(opts)
+
+	fh, err := os.Open(fn)
+	if err != nil {
+		return &Zip{}, errors.Wrap(err, "archive/zip")
+	}
+	fi, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		return &Zip{}, errors.Wrap(err, "archive/zip")
+	}
+
+	a, err := newZip(fn, fh, fi.Size(), o)
+	if err != nil {
+		fh.Close()
+		return a, err
+	}
+	a.fh = fh
+	return a, nil
+}
+
+// NewZipFromReaderAt uses r directly, without any buffering
+func NewZipFromReaderAt(r io.ReaderAt, size int64, opts ...Option) (*Zip, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	return newZip("-", r, size, newOptions(opts))
+}
+
+// NewZipFromReader reads the whole stream as zip needs random access.  Up to
+// DefaultMemoryLimit bytes (or WithMemoryLimit) are kept in memory, larger
+// streams go to a temporary file removed by Close().
+func NewZipFromReader(r io.Reader, opts ...Option) (*Zip, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	o := newOptions(opts)
+
+	ra, size, tmp, err := spool(r, "archive-*.zip", o.mem, o.log)
+	if err != nil {
+		return &Zip{}, errors.Wrap(err, "NewZipFromReader")
+	}
+
+	a, err := newZip("-", ra, size, o)
+	if err != nil {
+		unspool(tmp)
+		return a, err
+	}
+	if tmp != nil {
+		a.fh, a.tmp = tmp, tmp.Name()
+	}
+	return a, nil
+}
+
+// newZip reads the central directory.  What is read from r is counted for
+// Limits.MaxRatio, the compressed sizes in the directory can not be trusted.
+func newZip(fn string, r io.ReaderAt, size int64, o options) (*Zip, error) {
+	in := &counter{ra: r}
+	zfh, err := zip.NewReader(in, size)
 	if err != nil {
 		return &Zip{}, errors.Wrap(err, "archive/zip")
 	}
-	return &Zip{fn: fn, zfh: zfh}, nil
+	return &Zip{fn: fn, zfh: zfh, in: in, lim: o.lim, log: o.log}, nil
+}
+
+// spool gives random access to r, using it directly if possible.  Up to mem
+// bytes are kept in memory, above that they go to a temporary file which is
+// returned so that the caller can remove it.
+func spool(r io.Reader, pattern string, mem int64, l Logger) (io.ReaderAt, int64, *os.File, error) {
+	// No need to copy anything
+	if ra, ok := r.(interface {
+		io.ReaderAt
+		Size() int64
+	}); ok {
+		return ra, ra.Size(), nil, nil
+	}
+
+	var buf bytes.Buffer
+
+	n, err := io.CopyN(&buf, r, mem+1)
+	if err != nil && err != io.EOF {
+		return nil, 0, nil, errors.Wrap(err, "read")
+	}
+	if n <= mem {
+		return bytes.NewReader(buf.Bytes()), n, nil, nil
+	}
+
+	verbose(l, "archive too large, using a temp file", Field{"limit", mem})
+
+	tmp, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		return nil, 0, nil, errors.Wrap(err, "tempfile")
+	}
+
+	size, err := io.Copy(tmp, io.MultiReader(&buf, r))
+	if err != nil {
+		unspool(tmp)
+		return nil, 0, nil, errors.Wrap(err, "copy")
+	}
+	return tmp, size, tmp, nil
+}
+
+// unspool removes the temporary file from spool(), if any
+func unspool(tmp *os.File) {
+	if tmp != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
 }
 
 // Extract returns the content of the file
 func (a Zip) Extract(t string) ([]byte, error) {
-	verbose("exploring %s", a.fn)
+	verbose(a.log, "exploring", Field{"archive", a.fn})
+
+	g := newGuardAt(a.lim, a.in)
+	if err := g.add(a.fn, len(a.zfh.File)); err != nil {
+		return []byte{}, err
+	}
 
 	ft := strings.ToLower(t)
 	for _, fn := range a.zfh.File {
-		verbose("looking at %s", fn.Name)
+		verbose(a.log, "looking at", Field{"archive", a.fn}, Field{"member", fn.Name})
 
 		if path.Ext(fn.Name) == ft {
 			file, err := fn.Open()
 			if err != nil {
-				return []byte{}, errors.Wrapf(err, "no file matching type %s", t)
+				return []byte{}, &ArchiveError{Op: "open", Archive: a.fn, Member: fn.Name, Err: err}
 			}
-			return ioutil.ReadAll(file)
+			return ioutil.ReadAll(g.reader(fn.Name, file, -1))
 		}
 	}
 
-	return []byte{}, fmt.Errorf("no file matching type %s", t)
+	return []byte{}, notFound(a.fn, t)
 }
 
-// Close does something here
+// ExtractAll returns every file matching t in archive order, an empty t
+// matches all of them.
+func (a Zip) ExtractAll(t string) ([]Member, error) {
+	verbose(a.log, "exploring", Field{"archive", a.fn})
+
+	var all []Member
+
+	g := newGuardAt(a.lim, a.in)
+	if err := g.add(a.fn, len(a.zfh.File)); err != nil {
+		return all, err
+	}
+
+	ft := strings.ToLower(t)
+	for _, fn := range a.zfh.File {
+		verbose(a.log, "looking at", Field{"archive", a.fn}, Field{"member", fn.Name})
+
+		if fn.FileInfo().IsDir() || (t != "" && path.Ext(fn.Name) != ft) {
+			continue
+		}
+
+		file, err := fn.Open()
+		if err != nil {
+			return all, errors.Wrapf(err, "open %s", fn.Name)
+		}
+		content, err := ioutil.ReadAll(g.reader(fn.Name, file, -1))
+		file.Close()
+		if err != nil {
+			return all, errors.Wrapf(err, "read %s", fn.Name)
+		}
+		all = append(all, Member{Name: fn.Name, Data: content})
+	}
+
+	if len(all) == 0 {
+		return all, notFound(a.fn, t)
+	}
+	return all, nil
+}
+
+// Close does something here, removing the temporary file if any
 func (a Zip) Close() error {
-	return a.zfh.Close()
+	if a.fh == nil {
+		return nil
+	}
+	err := a.fh.Close()
+	if a.tmp != "" {
+		os.Remove(a.tmp)
+	}
+	return err
 }
 
 // Type returns the archive type obviously.
@@ -152,15 +367,22 @@ func (a Zip) Type() int {
 // Tar is a tar archive :)
 type Tar struct {
 	fn  string
+	typ int
 	tfh *tar.Reader
+	zfh io.Closer
+	fh  io.Closer
+	in  *counter
+	lim Limits
+	log Logger
 }
 
-func NewTarfile(fn string) (*Tar, error) {
-	var fh io.Reader
+// NewTarfile opens a tar file, compressed ones (.tar.gz, .tzst, etc.) too.
+// WithType(ArchiveTar|ArchiveGzip) forces the compression.
+func NewTarfile(fn string, opts ...Option) (*Tar, error) {
+	o := newOptions(opts)
 
 	if fn == "-" {
-		tfh := tar.NewReader(os.Stdin)
-		return &Tar{fn: fn, tfh: tfh}, nil
+		return newTar(fn, os.Stdin, o.typ&^ArchiveTar, o)
 	}
 
 	fh, err := os.Open(fn)
@@ -168,10 +390,40 @@ func NewTarfile(fn string) (*Tar, error) {
 		return &Tar{}, errors.Wrap(err, "NewTarfile")
 	}
 
-	return &Tar{fn: fn, tfh: tar.NewReader(fh)}, nil
+	// Do not try to uncompress a plain tar named .tgz
+	typ := o.typ
+	if typ == 0 {
+		typ = guessType(fn, o.log)
+	}
+	c := typ &^ ArchiveTar
+	if decompressor(c) == nil {
+		c = 0
+	}
+
+	a, err := newTar(fn, fh, c, o)
+	if err != nil {
+		fh.Close()
+		return a, err
+	}
+	a.fh = fh
+	return a, nil
+}
+
+// newTar puts a tar reader over r, uncompressing it first if c is set
+func newTar(fn string, r io.Reader, c int, o options) (*Tar, error) {
+	if c == 0 {
+		return &Tar{fn: fn, tfh: tar.NewReader(r), lim: o.lim, log: o.log}, nil
+	}
+
+	zfh, in, err := uncompress(r, c)
+	if err != nil {
+		return &Tar{}, errors.Wrap(err, "NewTarfile/uncompress")
+	}
+	return &Tar{fn: fn, typ: c, tfh: tar.NewReader(zfh), zfh: zfh, in: in, lim: o.lim, log: o.log}, nil
 }
 
 func (a Tar) Extract(t string) ([]byte, error) {
+	g := newGuard(a.lim, a.in)
 	for {
 		hdr, err := a.tfh.Next()
 		if err == io.EOF {
@@ -181,30 +433,81 @@ func (a Tar) Extract(t string) ([]byte, error) {
 			return []byte{}, errors.Wrap(err, "read")
 		}
 
-		debug("found %s", hdr.Name)
+		debug(a.log, "found", Field{"archive", a.fn}, Field{"member", hdr.Name})
+
+		if err := g.add(hdr.Name, 1); err != nil {
+			return []byte{}, err
+		}
 
 		var buf bytes.Buffer
 
 		if strings.HasSuffix(hdr.Name, t) {
-			n, err := io.Copy(&buf, a.tfh)
+			n, err := io.Copy(&buf, g.reader(hdr.Name, a.tfh, -1))
 			if err != nil {
 				return []byte{}, errors.Wrap(err, "copy")
 			}
-			debug("read %d bytes", n)
+			debug(a.log, "read", Field{"archive", a.fn}, Field{"member", hdr.Name}, Field{"bytes", n})
 			return buf.Bytes(), nil
 		}
 	}
-	return nil, errors.New("not found")
+	return nil, notFound(a.fn, t)
+}
+
+// ExtractAll returns every file matching t in archive order, an empty t
+// matches all of them.
+func (a Tar) ExtractAll(t string) ([]Member, error) {
+	var all []Member
+
+	g := newGuard(a.lim, a.in)
+	for {
+		hdr, err := a.tfh.Next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return all, errors.Wrap(err, "read")
+		}
+
+		debug(a.log, "found", Field{"archive", a.fn}, Field{"member", hdr.Name})
+
+		if err := g.add(hdr.Name, 1); err != nil {
+			return all, err
+		}
+
+		if !hdr.FileInfo().Mode().IsRegular() || !strings.HasSuffix(hdr.Name, t) {
+			continue
+		}
+
+		var buf bytes.Buffer
+
+		n, err := io.Copy(&buf, g.reader(hdr.Name, a.tfh, -1))
+		if err != nil {
+			return all, errors.Wrapf(err, "copy %s", hdr.Name)
+		}
+		debug(a.log, "read", Field{"archive", a.fn}, Field{"member", hdr.Name}, Field{"bytes", n})
+		all = append(all, Member{Name: hdr.Name, Data: buf.Bytes()})
+	}
+
+	if len(all) == 0 {
+		return all, notFound(a.fn, t)
+	}
+	return all, nil
 }
 
 // Close does something here
 func (a Tar) Close() error {
+	if a.zfh != nil {
+		a.zfh.Close()
+	}
+	if a.fh != nil {
+		return a.fh.Close()
+	}
 	return nil
 }
 
-// Type returns the archive type obviously.
+// Type returns the archive type obviously, with the compression bit if any.
 func (a *Tar) Type() int {
-	return ArchiveTar
+	return ArchiveTar | a.typ
 }
 
 // ------------------- Gzip
@@ -214,28 +517,31 @@ type Gzip struct {
 	fn  string
 	unc string
 	gfh io.Reader
+	lim Limits
+	log Logger
 }
 
 // NewGzipfile stores the uncompressed file name
-func NewGzipfile(fn string) (*Gzip, error) {
-	base := filepath.Base(fn)
-	pc := strings.Split(base, ".")
-	unc := strings.Join(pc[0:len(pc)-1], ".")
+func NewGzipfile(fn string, opts ...Option) (*Gzip, error) {
+	o := newOptions(opts)
+	unc := uncName(fn)
 
 	gfh, err := os.Open(fn)
 	if err != nil {
 		return &Gzip{}, errors.Wrap(err, "NewGzipFile")
 	}
-	return &Gzip{fn: fn, unc: unc, gfh: gfh}, nil
+	return &Gzip{fn: fn, unc: unc, gfh: gfh, lim: o.lim, log: o.log}, nil
 }
 
 // Extract returns the content of the file
 func (a Gzip) Extract(t string) ([]byte, error) {
-	zfh, err := gzip.NewReader(a.gfh)
+	in := &counter{r: a.gfh}
+	zfh, err := gzip.NewReader(in)
 	if err != nil {
 		return []byte{}, errors.Wrap(err, "gunzip")
 	}
-	content, err := ioutil.ReadAll(zfh)
+	g := newGuard(a.lim, in)
+	content, err := ioutil.ReadAll(g.reader(a.unc, zfh, -1))
 	defer zfh.Close()
 
 	return content, err
@@ -258,28 +564,31 @@ type Zstd struct {
 	fn  string
 	unc string
 	gfh io.Reader
+	lim Limits
+	log Logger
 }
 
 // NewZstdfile stores the uncompressed file name
-func NewZstdfile(fn string) (*Zstd, error) {
-	base := filepath.Base(fn)
-	pc := strings.Split(base, ".")
-	unc := strings.Join(pc[0:len(pc)-1], ".")
+func NewZstdfile(fn string, opts ...Option) (*Zstd, error) {
+	o := newOptions(opts)
+	unc := uncName(fn)
 
 	gfh, err := os.Open(fn)
 	if err != nil {
 		return &Zstd{}, errors.Wrap(err, "NewZstdFile")
 	}
-	return &Zstd{fn: fn, unc: unc, gfh: gfh}, nil
+	return &Zstd{fn: fn, unc: unc, gfh: gfh, lim: o.lim, log: o.log}, nil
 }
 
 // Extract returns the content of the file
 func (a Zstd) Extract(t string) ([]byte, error) {
-	zfh, err := zstd.NewReader(a.gfh)
+	in := &counter{r: a.gfh}
+	zfh, err := zstd.NewReader(in)
 	if err != nil {
 		return []byte{}, errors.Wrap(err, "zstd uncompress")
 	}
-	content, err := ioutil.ReadAll(zfh)
+	g := newGuard(a.lim, in)
+	content, err := ioutil.ReadAll(g.reader(a.unc, zfh, -1))
 	defer zfh.Close()
 
 	return content, err
@@ -295,95 +604,424 @@ func (a Zstd) Type() int {
 	return ArchiveZstd
 }
 
+// ------------------- Bzip2
+
+// Bzip2 is a bzip2-compressed file
+type Bzip2 struct {
+	stream
+}
+
+// NewBzip2file stores the uncompressed file name
+func NewBzip2file(fn string, opts ...Option) (*Bzip2, error) {
+	s, err := openStream(fn, "bzip2", anyLimits(bzip2Reader), opts)
+	return &Bzip2{s}, err
+}
+
+// Type returns the archive type obviously.
+func (a Bzip2) Type() int {
+	return ArchiveBzip2
+}
+
+// bzip2Reader is the decompressor
+func bzip2Reader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(bzip2.NewReader(r)), nil
+}
+
+// ------------------- Xz
+
+// Xz is a xz-compressed file.  Concatenated streams are read one after the
+// other and the integrity check of every block is verified.
+type Xz struct {
+	stream
+}
+
+// NewXzfile stores the uncompressed file name
+func NewXzfile(fn string, opts ...Option) (*Xz, error) {
+	s, err := openStream(fn, "xz", xzReader, opts)
+	return &Xz{s}, err
+}
+
+// Type returns the archive type obviously.
+func (a Xz) Type() int {
+	return ArchiveXz
+}
+
+// xzReader is the decompressor, see Limits.MaxDict
+func xzReader(r io.Reader, lim Limits) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	if err := xzCheckDict(br, lim.maxDict()); err != nil {
+		return nil, err
+	}
+	zfh, err := xz.ReaderConfig{DictCap: lim.maxDict()}.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(zfh), nil
+}
+
+// xzCheckDict looks at the dictionary size in the first block header as the
+// one from the LZMA2 filter wins over ReaderConfig.DictCap.  Only the first
+// block is checked, xz(1) uses the same dictionary for all of them.
+func xzCheckDict(br *bufio.Reader, max int) error {
+	const streamHdr = 12
+
+	buf, _ := br.Peek(streamHdr + 1)
+	if len(buf) <= streamHdr || buf[streamHdr] == 0 {
+		// Let xz complain or read the empty stream
+		return nil
+	}
+	hdr, err := br.Peek(streamHdr + (int(buf[streamHdr])+1)*4)
+	if err != nil {
+		return nil
+	}
+	hdr = hdr[streamHdr+1:]
+
+	flags := hdr[0]
+	hdr = hdr[1:]
+	for _, bit := range []byte{0x40, 0x80} {
+		if flags&bit != 0 {
+			_, n := binary.Uvarint(hdr)
+			if n <= 0 {
+				return nil
+			}
+			hdr = hdr[n:]
+		}
+	}
+	for i := 0; i <= int(flags&3); i++ {
+		id, n := binary.Uvarint(hdr)
+		if n <= 0 {
+			return nil
+		}
+		hdr = hdr[n:]
+		size, n := binary.Uvarint(hdr)
+		if n <= 0 || size > uint64(len(hdr[n:])) {
+			return nil
+		}
+		props := hdr[n : n+int(size)]
+		hdr = hdr[n+int(size):]
+
+		if id == 0x21 && size == 1 {
+			dc, err := lzma.DecodeDictCap(props[0])
+			if err == nil && dc > int64(max) {
+				return errors.Wrapf(ErrLimitExceeded, "xz dictionary of %d bytes", dc)
+			}
+		}
+	}
+	return nil
+}
+
+// ------------------- Lzma
+
+// Lzma is the old .lzma format, without any integrity check
+type Lzma struct {
+	stream
+}
+
+// NewLzmafile stores the uncompressed file name
+func NewLzmafile(fn string, opts ...Option) (*Lzma, error) {
+	s, err := openStream(fn, "lzma", lzmaReader, opts)
+	return &Lzma{s}, err
+}
+
+// Type returns the archive type obviously.
+func (a Lzma) Type() int {
+	return ArchiveLzma
+}
+
+// lzmaReader is the decompressor, see Limits.MaxDict
+func lzmaReader(r io.Reader, lim Limits) (io.ReadCloser, error) {
+	zfh, err := lzma.ReaderConfig{DictCap: lim.maxDict()}.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(zfh), nil
+}
+
+// ------------------- Lz4
+
+// Lz4 is a lz4-compressed file, using the frame format
+type Lz4 struct {
+	stream
+}
+
+// NewLz4file stores the uncompressed file name
+func NewLz4file(fn string, opts ...Option) (*Lz4, error) {
+	s, err := openStream(fn, "lz4", anyLimits(lz4Reader), opts)
+	return &Lz4{s}, err
+}
+
+// Type returns the archive type obviously.
+func (a Lz4) Type() int {
+	return ArchiveLz4
+}
+
+// lz4Reader is the decompressor
+func lz4Reader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(lz4.NewReader(r)), nil
+}
+
+// ------------------- Snappy
+
+// Snappy is a snappy-compressed file, using the framing format (not the raw
+// block one which has no magic)
+type Snappy struct {
+	stream
+}
+
+// NewSnappyfile stores the uncompressed file name
+func NewSnappyfile(fn string, opts ...Option) (*Snappy, error) {
+	s, err := openStream(fn, "snappy", anyLimits(snappyReader), opts)
+	return &Snappy{s}, err
+}
+
+// Type returns the archive type obviously.
+func (a Snappy) Type() int {
+	return ArchiveSnappy
+}
+
+// snappyReader is the decompressor, s2 reads snappy streams too
+func snappyReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(s2.NewReader(r)), nil
+}
+
+// ------------------- Brotli
+
+// Brotli is a brotli-compressed file.  There is no magic number so it is
+// only used for .br files or when asked explicitly.
+type Brotli struct {
+	stream
+}
+
+// NewBrotlifile stores the uncompressed file name
+func NewBrotlifile(fn string, opts ...Option) (*Brotli, error) {
+	s, err := openStream(fn, "brotli", anyLimits(brotliReader), opts)
+	return &Brotli{s}, err
+}
+
+// Type returns the archive type obviously.
+func (a Brotli) Type() int {
+	return ArchiveBrotli
+}
+
+// brotliReader is the decompressor
+func brotliReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(brotli.NewReader(r)), nil
+}
+
+// ------------------- Compress
+
+// Compress is a file made by the old Unix compress(1), see lzw.go
+type Compress struct {
+	stream
+}
+
+// NewCompressfile stores the uncompressed file name
+func NewCompressfile(fn string, opts ...Option) (*Compress, error) {
+	s, err := openStream(fn, "compress", anyLimits(compressReader), opts)
+	return &Compress{s}, err
+}
+
+// Type returns the archive type obviously.
+func (a Compress) Type() int {
+	return ArchiveCompress
+}
+
+// ------------------- Zlib
+
+// Zlib is a zlib stream (RFC 1950), deflate with a small header and a
+// checksum.  This is what is sent with "Content-Encoding: deflate".
+type Zlib struct {
+	stream
+}
+
+// NewZlibfile stores the uncompressed file name
+func NewZlibfile(fn string, opts ...Option) (*Zlib, error) {
+	s, err := openStream(fn, "zlib", anyLimits(zlibReader), opts)
+	return &Zlib{s}, err
+}
+
+// Type returns the archive type obviously.
+func (a Zlib) Type() int {
+	return ArchiveZlib
+}
+
+// zlibReader is the decompressor
+func zlibReader(r io.Reader) (io.ReadCloser, error) {
+	return zlib.NewReader(r)
+}
+
+// ------------------- Deflate
+
+// Deflate is a raw deflate stream (RFC 1951) without any header, some HTTP
+// servers send these instead of zlib.  It is only used for .deflate files or
+// when asked explicitly.
+type Deflate struct {
+	stream
+}
+
+// NewDeflatefile stores the uncompressed file name
+func NewDeflatefile(fn string, opts ...Option) (*Deflate, error) {
+	s, err := openStream(fn, "deflate", anyLimits(deflateReader), opts)
+	return &Deflate{s}, err
+}
+
+// Type returns the archive type obviously.
+func (a Deflate) Type() int {
+	return ArchiveDeflate
+}
+
+// deflateReader is the decompressor
+func deflateReader(r io.Reader) (io.ReadCloser, error) {
+	return flate.NewReader(r), nil
+}
+
 // ------------------- New/NewFromReader
 
-// New is the main creator
-func New(fn string) (ExtractCloser, error) {
+// New is the main creator, the type is found by looking at the content
+// first then at the extension unless WithType() is used.
+func New(fn string, opts ...Option) (ExtractCloser, error) {
 	if fn == "" {
-		return &Plain{}, fmt.Errorf("null string")
+		return &Plain{}, errors.Wrap(ErrNoFilename, "New")
 	}
 	_, err := os.Stat(fn)
 	if err != nil {
 		return nil, errors.Wrap(err, "unknown file")
 	}
-	ext := filepath.Ext(fn)
-	switch ext {
-	case ".zip":
-		return NewZipfile(fn)
-	case ".gz":
-		return NewGzipfile(fn)
-	case ".zst":
-		return NewZstdfile(fn)
-	case ".asc":
-		fallthrough
-	case ".gpg":
-		return NewGpgfile(fn)
-	case ".tar":
-		return NewTarfile(fn)
-	}
-	return NewPlainfile(fn)
-}
-
-// NewFromReader uses an io.Reader instead of a file
-func NewFromReader(r io.Reader, t int) (ExtractCloser, error) {
+	o := newOptions(opts)
+
+	typ := o.typ
+	if typ == 0 {
+		typ = guessType(fn, o.log)
+	}
+	f, ok := lookupFormat(typ)
+	if !ok {
+		return NewPlainfile(fn, opts...)
+	}
+	if f.Open == nil {
+		return nil, errors.Wrapf(ErrUnsupported, "%s from a file", f.Name)
+	}
+	return f.Open(fn, opts...)
+}
+
+// NewFromReader uses an io.Reader instead of a file.  If t is 0, the type is
+// the one given by WithType() or detected from the content.
+func NewFromReader(r io.Reader, t int, opts ...Option) (ExtractCloser, error) {
 	if r == nil {
-		return nil, fmt.Errorf("nil reader")
-	}
-	fn := "-"
-	switch t {
-	case ArchivePlain:
-		return &Plain{Name: fn, r: r}, nil
-	case ArchiveGzip:
-		return &Gzip{fn: fn, unc: fn, gfh: r}, nil
-	case ArchiveZstd:
-		return &Zstd{fn: fn, unc: fn, gfh: r}, nil
-	case ArchiveZip:
-		return nil, fmt.Errorf("not supported")
-	case ArchiveGpg:
-		return NewGpgfile(fn)
-	case ArchiveTar:
-		return NewTarfile(fn)
-	}
-	return &Plain{Name: fn, r: r}, fmt.Errorf("unknown type")
-}
-
-// Ext2Type converts from string to archive type (int)
+		return nil, ErrNilReader
+	}
+	o := newOptions(opts)
+
+	if t == 0 {
+		t = o.typ
+	}
+	if t == 0 {
+		var err error
+
+		t, r, err = Detect(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "NewFromReader")
+		}
+	}
+	if isTar(t) {
+		return newTar("-", r, t&^ArchiveTar, o)
+	}
+	if isCpio(t) {
+		return newCpio("-", r, t&^ArchiveCpio, o)
+	}
+	f, ok := lookupFormat(t)
+	if !ok {
+		return &Plain{Name: "-", r: r}, errors.Wrapf(ErrUnsupported, "type %d", t)
+	}
+	if f.OpenReader == nil {
+		return nil, errors.Wrapf(ErrUnsupported, "%s from a stream", f.Name)
+	}
+	return f.OpenReader(r, opts...)
+}
+
+// containers are the archive formats often compressed as a whole like
+// ".tar.gz" or ".cpio.gz"
+var containers = []struct {
+	ext string
+	typ int
+}{
+	{".tar", ArchiveTar},
+	{".cpio", ArchiveCpio},
+}
+
+// Ext2Type converts from string to archive type (int).  Compressed tarballs
+// like ".tar.gz" or ".tgz" get both bits set (ArchiveTar|ArchiveGzip), same
+// for cpio archives (".cpio.gz").
 func Ext2Type(typ string) int {
-	switch typ {
-	case ".zip":
-		return ArchiveZip
-	case ".gz":
-		return ArchiveGzip
-	case ".zst":
-		return ArchiveZstd
-	case ".asc":
-		fallthrough
-	case ".gpg":
-		return ArchiveGpg
-	case ".tar":
-		return ArchiveTar
-	default:
-		return ArchivePlain
+	for _, ct := range containers {
+		if strings.HasPrefix(typ, ct.ext+".") {
+			c := Ext2Type(strings.TrimPrefix(typ, ct.ext))
+			if decompressor(c) != nil {
+				return ct.typ | c
+			}
+			return ArchivePlain
+		}
+	}
+
+	for _, f := range registered() {
+		for _, ext := range f.TarAliases {
+			if ext == typ && f.Decompress != nil {
+				return ArchiveTar | f.Type
+			}
+		}
+		for _, ext := range f.Extensions {
+			if ext == typ {
+				return f.Type
+			}
+		}
+	}
+	return ArchivePlain
+}
+
+// isContainer tells whether t is the container ct, compressed or not
+func isContainer(t, ct int) bool {
+	if t&ct == 0 {
+		return false
+	}
+	return t == ct || decompressor(t&^ct) != nil
+}
+
+// isTar tells whether t is a tar archive, compressed or not
+func isTar(t int) bool {
+	return isContainer(t, ArchiveTar)
+}
+
+// isCpio tells whether t is a cpio archive, compressed or not
+func isCpio(t int) bool {
+	return isContainer(t, ArchiveCpio)
+}
+
+// FullExt returns the extension of fn, including ".tar" for compressed
+// tarballs (".tar.gz" and not just ".gz") and ".cpio" for cpio archives.
+func FullExt(fn string) string {
+	ext := filepath.Ext(fn)
+	for _, ct := range containers {
+		if ext != ct.ext && strings.HasSuffix(strings.TrimSuffix(fn, ext), ct.ext) {
+			return ct.ext + ext
+		}
 	}
+	return ext
 }
 
 // ------------------- Misc.
 
-// SetVerbose sets the mode
+// SetVerbose sets the default logger to LevelInfo
 func SetVerbose() {
-	fVerbose = true
+	defaultLogger.SetLevel(LevelInfo)
 }
 
-// SetDebug sets the mode too
+// SetDebug sets it to LevelDebug, which implies verbose
 func SetDebug() {
-	fDebug = true
-	fVerbose = true
+	defaultLogger.SetLevel(LevelDebug)
 }
 
-// Reset is for the two flags
+// Reset silences the default logger again
 func Reset() {
-	fDebug = false
-	fVerbose = false
+	defaultLogger.SetLevel(LevelNone)
 }
 
 // Version reports it
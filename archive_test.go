@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -17,25 +19,23 @@ func TestVersion(t *testing.T) {
 }
 
 func TestSetVerbose(t *testing.T) {
-	assert.False(t, fVerbose)
+	assert.Equal(t, LevelNone, defaultLogger.Level())
 	SetVerbose()
-	assert.True(t, fVerbose)
-	fVerbose = false
+	assert.Equal(t, LevelInfo, defaultLogger.Level())
+	Reset()
 }
 
 func TestSetDebug(t *testing.T) {
-	assert.False(t, fDebug)
+	assert.Equal(t, LevelNone, defaultLogger.Level())
 	SetDebug()
-	assert.True(t, fDebug)
-	assert.True(t, fVerbose)
-	fDebug = false
-	fVerbose = false
+	assert.Equal(t, LevelDebug, defaultLogger.Level())
+	Reset()
 }
 
 func TestReset(t *testing.T) {
-	fVerbose = true
+	SetVerbose()
 	Reset()
-	require.False(t, fVerbose)
+	require.Equal(t, LevelNone, defaultLogger.Level())
 }
 
 // NewArchive
@@ -43,6 +43,7 @@ func TestReset(t *testing.T) {
 func TestNewArchive_Empty(t *testing.T) {
 	a, err := New("")
 	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrNoFilename))
 	assert.Empty(t, a)
 	assert.IsType(t, (*Plain)(nil), a)
 }
@@ -99,6 +100,13 @@ func TestNewArchive_Zstd_Bad(t *testing.T) {
 	assert.Empty(t, a)
 }
 
+func TestNewArchive_Bzip2(t *testing.T) {
+	a, err := New("testdata/notempty.txt.bz2")
+	require.NoError(t, err)
+	assert.NotEmpty(t, a)
+	assert.IsType(t, (*Bzip2)(nil), a)
+}
+
 func TestNewArchive_Gpg(t *testing.T) {
 	a, err := New("testdata/notempty.asc")
 	require.NoError(t, err)
@@ -231,6 +239,36 @@ func TestZip_Extract2(t *testing.T) {
 	assert.Empty(t, txt)
 }
 
+func TestZip_ExtractAll(t *testing.T) {
+	file := mkZip(t,
+		member{"a.xml", []byte("<a/>")},
+		member{"dir/", nil},
+		member{"README", []byte("foo")},
+		member{"dir/c.xml", []byte("<c/>")},
+		member{"b.xml", []byte("<b/>")},
+	)
+
+	a, err := NewZipFromReaderAt(bytes.NewReader(file), int64(len(file)))
+	require.NoError(t, err)
+	require.Implements(t, (*MultiExtracter)(nil), a)
+
+	all, err := a.ExtractAll(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, []Member{
+		{"a.xml", []byte("<a/>")},
+		{"dir/c.xml", []byte("<c/>")},
+		{"b.xml", []byte("<b/>")},
+	}, all)
+
+	all, err = a.ExtractAll("")
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+
+	all, err = a.ExtractAll(".doc")
+	require.Error(t, err)
+	assert.Empty(t, all)
+}
+
 func TestZip_Close(t *testing.T) {
 	fn := "testdata/notempty.zip"
 	a, err := New(fn)
@@ -519,6 +557,75 @@ func TestZstd_Close(t *testing.T) {
 	require.NoError(t, a.Close())
 }
 
+// Bzip2
+
+func TestNewBzip2file(t *testing.T) {
+	a, err := NewBzip2file("testdata/notempty.txt.bz2")
+	require.NoError(t, err)
+	assert.NotEmpty(t, a)
+	assert.IsType(t, (*Bzip2)(nil), a)
+}
+
+func TestBzip2file_Bad(t *testing.T) {
+	a, err := NewBzip2file("/nonexistent")
+	require.Error(t, err)
+	assert.Empty(t, a)
+}
+
+func TestBzip2_Extract(t *testing.T) {
+	a, err := New("testdata/notempty.txt.bz2")
+	require.NoError(t, err)
+	require.NotNil(t, a)
+	defer a.Close()
+
+	rh, err := ioutil.ReadFile("testdata/notempty.txt")
+	require.NoError(t, err)
+	require.NotEmpty(t, rh)
+
+	txt, err := a.Extract(".txt")
+	assert.NoError(t, err)
+	assert.Equal(t, string(rh), string(txt))
+	assert.Equal(t, ArchiveBzip2, a.Type())
+}
+
+func TestBzip2_Extract_Bad(t *testing.T) {
+	a, err := NewFromReader(bytes.NewBufferString("BZh9 is not enough"), ArchiveBzip2)
+	require.NoError(t, err)
+
+	_, err = a.Extract(".txt")
+	assert.Error(t, err)
+}
+
+func TestBzip2_Extract_FromReader(t *testing.T) {
+	fh, err := os.Open("testdata/notempty.txt.bz2")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	bn, err := ioutil.ReadFile("testdata/notempty.txt")
+	require.NoError(t, err)
+	require.NotEmpty(t, bn)
+
+	a, err := NewFromReader(fh, ArchiveBzip2)
+	require.NoError(t, err)
+	require.NotEmpty(t, a)
+
+	content, err := a.Extract("")
+	assert.NoError(t, err)
+	assert.EqualValues(t, bn, content)
+}
+
+func TestBzip2_Close(t *testing.T) {
+	a, err := New("testdata/notempty.txt.bz2")
+	require.NoError(t, err)
+	require.NotNil(t, a)
+
+	require.NoError(t, a.Close())
+
+	// The file is not leaked
+	_, err = a.(*Bzip2).gfh.Read(make([]byte, 1))
+	assert.True(t, errors.Is(err, os.ErrClosed), "%v", err)
+}
+
 // Tar
 
 func TestNewTarfile(t *testing.T) {
@@ -594,6 +701,138 @@ func TestTar_Close(t *testing.T) {
 	require.NoError(t, a.Close())
 }
 
+func TestTar_ExtractAll(t *testing.T) {
+	file := mkTar(t,
+		member{"a.xml", []byte("<a/>")},
+		member{"README", []byte("foo")},
+		member{"dir/c.xml", []byte("<c/>")},
+	)
+
+	a, err := NewFromReader(bytes.NewReader(file), ArchiveTar)
+	require.NoError(t, err)
+	require.Implements(t, (*MultiExtracter)(nil), a)
+
+	all, err := a.(MultiExtracter).ExtractAll(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, []Member{
+		{"a.xml", []byte("<a/>")},
+		{"dir/c.xml", []byte("<c/>")},
+	}, all)
+}
+
+func TestTar_ExtractAll_Compressed(t *testing.T) {
+	a, err := New("testdata/notempty.tar.gz")
+	require.NoError(t, err)
+	defer a.Close()
+
+	all, err := a.(MultiExtracter).ExtractAll(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, []Member{
+		{"empty.txt", []byte{}},
+		{"notempty.txt", []byte("this is a file\n")},
+	}, all)
+}
+
+func TestTar_ExtractAll_None(t *testing.T) {
+	a, err := New("testdata/notempty.tar")
+	require.NoError(t, err)
+	defer a.Close()
+
+	all, err := a.(MultiExtracter).ExtractAll(".xml")
+	require.Error(t, err)
+	assert.Empty(t, all)
+}
+
+func TestTar_Compressed(t *testing.T) {
+	td := []struct {
+		fn  string
+		typ int
+	}{
+		{"testdata/notempty.tar.gz", ArchiveTar | ArchiveGzip},
+		{"testdata/notempty.tar.zst", ArchiveTar | ArchiveZstd},
+		{"testdata/notempty.tar.bz2", ArchiveTar | ArchiveBzip2},
+		{"testdata/notempty.tar.xz", ArchiveTar | ArchiveXz},
+		{"testdata/notempty.tar.lzma", ArchiveTar | ArchiveLzma},
+		{"testdata/notempty.tar.lz4", ArchiveTar | ArchiveLz4},
+		{"testdata/notempty.tar.sz", ArchiveTar | ArchiveSnappy},
+		{"testdata/notempty.tar.br", ArchiveTar | ArchiveBrotli},
+		{"testdata/notempty.tar.Z", ArchiveTar | ArchiveCompress},
+		{"testdata/notempty.tar.zlib", ArchiveTar | ArchiveZlib},
+		{"testdata/notempty.tar.deflate", ArchiveTar | ArchiveDeflate},
+	}
+
+	for _, d := range td {
+		a, err := New(d.fn)
+		require.NoError(t, err)
+		require.IsType(t, (*Tar)(nil), a)
+		assert.Equal(t, d.typ, a.Type())
+
+		txt, err := a.Extract("notempty.txt")
+		assert.NoError(t, err)
+		assert.Equal(t, "this is a file\n", string(txt))
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestTar_CompressedAlias(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	td := []struct {
+		in, out string
+		typ     int
+	}{
+		{"testdata/notempty.tar.gz", "notempty.tgz", ArchiveTar | ArchiveGzip},
+		{"testdata/notempty.tar.zst", "notempty.tzst", ArchiveTar | ArchiveZstd},
+		{"testdata/notempty.tar.bz2", "notempty.tbz2", ArchiveTar | ArchiveBzip2},
+		{"testdata/notempty.tar.bz2", "notempty.tbz", ArchiveTar | ArchiveBzip2},
+		{"testdata/notempty.tar.xz", "notempty.txz", ArchiveTar | ArchiveXz},
+		{"testdata/notempty.tar.lzma", "notempty.tlz", ArchiveTar | ArchiveLzma},
+		{"testdata/notempty.tar.Z", "notempty.taZ", ArchiveTar | ArchiveCompress},
+		{"testdata/notempty.tar", "notcompressed.tgz", ArchiveTar},
+	}
+
+	for _, d := range td {
+		file, err := ioutil.ReadFile(d.in)
+		require.NoError(t, err)
+
+		fn := filepath.Join(dir, d.out)
+		require.NoError(t, ioutil.WriteFile(fn, file, 0644))
+
+		a, err := New(fn)
+		require.NoError(t, err)
+		require.IsType(t, (*Tar)(nil), a)
+		assert.Equal(t, d.typ, a.Type(), d.out)
+
+		txt, err := a.Extract(".txt")
+		assert.NoError(t, err)
+		assert.Empty(t, txt, "first .txt is empty.txt")
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestTar_Compressed_FromReader(t *testing.T) {
+	fh, err := os.Open("testdata/notempty.tar.zst")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	a, err := NewFromReader(fh, ArchiveTar|ArchiveZstd)
+	require.NoError(t, err)
+	assert.Equal(t, ArchiveTar|ArchiveZstd, a.Type())
+
+	txt, err := a.Extract("notempty.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+	require.NoError(t, a.Close())
+}
+
+func TestTar_Compressed_Bad(t *testing.T) {
+	a, err := NewFromReader(bytes.NewBufferString("foobar\n"), ArchiveTar|ArchiveGzip)
+	require.Error(t, err)
+	assert.Empty(t, a)
+}
+
 // FromReader
 
 func TestNewFromReader_Nil(t *testing.T) {
@@ -648,10 +887,66 @@ func TestNewFromReader_Zip(t *testing.T) {
 	assert.Equal(t, len(file), n)
 
 	a, err := NewFromReader(&buf, ArchiveZip)
-	assert.Error(t, err)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, a)
+	require.Equal(t, ArchiveZip, a.Type())
+	defer a.Close()
+
+	txt, err := a.Extract(".txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+}
+
+func TestNewZipFromReader_Spill(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.zip")
+	require.NoError(t, err)
+
+	a, err := NewZipFromReader(bytes.NewBuffer(file), WithMemoryLimit(16))
+	require.NoError(t, err)
+	require.NotEmpty(t, a.tmp)
+
+	_, err = os.Stat(a.tmp)
+	require.NoError(t, err)
+
+	txt, err := a.Extract(".txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+
+	require.NoError(t, a.Close())
+	_, err = os.Stat(a.tmp)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestNewZipFromReader_Garbage(t *testing.T) {
+	a, err := NewZipFromReader(bytes.NewBufferString("foobar\n"))
+	require.Error(t, err)
 	assert.Empty(t, a)
 }
 
+func TestNewZipFromReader_Nil(t *testing.T) {
+	a, err := NewZipFromReader(nil)
+	require.Error(t, err)
+	assert.Nil(t, a)
+}
+
+func TestNewZipFromReaderAt(t *testing.T) {
+	fh, err := os.Open("testdata/notempty.zip")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	fi, err := fh.Stat()
+	require.NoError(t, err)
+
+	a, err := NewZipFromReaderAt(fh, fi.Size())
+	require.NoError(t, err)
+	require.Empty(t, a.tmp)
+
+	txt, err := a.Extract(".txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+	require.NoError(t, a.Close())
+}
+
 func TestNewFromReader_Gzip(t *testing.T) {
 	file, err := ioutil.ReadFile("testdata/notempty.txt.gz")
 	assert.NoError(t, err)
@@ -684,6 +979,10 @@ func TestNewFromReader_Tar(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotEmpty(t, a)
 	require.Equal(t, ArchiveTar, a.Type())
+
+	txt, err := a.Extract("notempty.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
 }
 
 func TestNewFromReader_Invalid(t *testing.T) {
@@ -700,7 +999,7 @@ func TestNewFromReader_Invalid(t *testing.T) {
 	a, err := NewFromReader(&buf, 666)
 	assert.Error(t, err)
 	assert.NotEmpty(t, a)
-	assert.Equal(t, &Plain{"-", &buf}, a)
+	assert.Equal(t, &Plain{Name: "-", r: &buf}, a)
 }
 
 func TestExt2Type(t *testing.T) {
@@ -715,9 +1014,70 @@ func TestExt2Type(t *testing.T) {
 		{".gpg", ArchiveGpg},
 		{".tar", ArchiveTar},
 		{".txt", ArchivePlain},
+		{".tar.gz", ArchiveTar | ArchiveGzip},
+		{".tgz", ArchiveTar | ArchiveGzip},
+		{".tar.zst", ArchiveTar | ArchiveZstd},
+		{".tzst", ArchiveTar | ArchiveZstd},
+		{".bz2", ArchiveBzip2},
+		{".bz", ArchiveBzip2},
+		{".tar.bz2", ArchiveTar | ArchiveBzip2},
+		{".tbz2", ArchiveTar | ArchiveBzip2},
+		{".xz", ArchiveXz},
+		{".tar.xz", ArchiveTar | ArchiveXz},
+		{".txz", ArchiveTar | ArchiveXz},
+		{".lzma", ArchiveLzma},
+		{".tar.lzma", ArchiveTar | ArchiveLzma},
+		{".lz4", ArchiveLz4},
+		{".tar.lz4", ArchiveTar | ArchiveLz4},
+		{".sz", ArchiveSnappy},
+		{".tar.sz", ArchiveTar | ArchiveSnappy},
+		{".br", ArchiveBrotli},
+		{".tar.br", ArchiveTar | ArchiveBrotli},
+		{".Z", ArchiveCompress},
+		{".tar.Z", ArchiveTar | ArchiveCompress},
+		{".taZ", ArchiveTar | ArchiveCompress},
+		{".zlib", ArchiveZlib},
+		{".zz", ArchiveZlib},
+		{".tar.zlib", ArchiveTar | ArchiveZlib},
+		{".deflate", ArchiveDeflate},
+		{".7z", ArchiveSevenZip},
+		{".rar", ArchiveRar},
+		{".cpio", ArchiveCpio},
+		{".cpio.gz", ArchiveCpio | ArchiveGzip},
+		{".cpio.zst", ArchiveCpio | ArchiveZstd},
+		{".cpio.txt", ArchivePlain},
+		{".a", ArchiveAr},
+		{".deb", ArchiveDeb},
+		{".rpm", ArchiveRpm},
+		{".iso", ArchiveIso},
+		{".tar.deflate", ArchiveTar | ArchiveDeflate},
+		{".tar.txt", ArchivePlain},
+	}
+
+	for _, d := range td {
+		assert.Equal(t, d.out, Ext2Type(d.ins), d.ins)
+	}
+}
+
+func TestFullExt(t *testing.T) {
+	td := []struct {
+		ins string
+		out string
+	}{
+		{"", ""},
+		{"foo", ""},
+		{"foo.txt", ".txt"},
+		{"foo.txt.gz", ".gz"},
+		{"foo.tar.gz", ".tar.gz"},
+		{"dir.tar/foo.gz", ".gz"},
+		{"foo.tgz", ".tgz"},
+		{"foo.tar", ".tar"},
+		{"foo.tar.tar", ".tar"},
+		{"initrd.cpio.gz", ".cpio.gz"},
+		{"foo.cpio", ".cpio"},
 	}
 
 	for _, d := range td {
-		assert.Equal(t, d.out, Ext2Type(d.ins))
+		assert.Equal(t, d.out, FullExt(d.ins), d.ins)
 	}
 }
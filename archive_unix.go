@@ -8,8 +8,6 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/pkg/errors"
 	"github.com/proglottis/gpgme"
@@ -23,11 +21,94 @@ type Decrypter interface {
 }
 
 // Gpgme is for real gpgme stuff
-type Gpgme struct{}
+type Gpgme struct {
+	// Password is given to gpg instead of asking the agent, see WithPassword
+	Password string
+}
 
-// Decrypt does the obvious
-func (Gpgme) Decrypt(r io.Reader) (*gpgme.Data, error) {
-	return gpgme.Decrypt(r)
+// context gives the password to gpg if we have one
+func (g Gpgme) context() (*gpgme.Context, error) {
+	ctx, err := gpgme.New()
+	if err != nil {
+		return nil, err
+	}
+	if g.Password == "" {
+		return ctx, nil
+	}
+
+	// Loopback makes gpg call us instead of pinentry
+	if err := ctx.SetPinEntryMode(gpgme.PinEntryLoopback); err != nil {
+		ctx.Release()
+		return nil, err
+	}
+	err = ctx.SetCallback(func(uid string, prevWasBad bool, f *os.File) error {
+		if prevWasBad {
+			return errors.New("bad password")
+		}
+		_, err := io.WriteString(f, g.Password+"\n")
+		return err
+	})
+	if err != nil {
+		ctx.Release()
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// Decrypt does the obvious, the whole plain text is kept by gpgme
+func (g Gpgme) Decrypt(r io.Reader) (*gpgme.Data, error) {
+	if g.Password == "" {
+		return gpgme.Decrypt(r)
+	}
+
+	ctx, err := g.context()
+	if err != nil {
+		return nil, err
+	}
+	defer ctx.Release()
+
+	cipher, err := gpgme.NewDataReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer cipher.Close()
+
+	plain, err := gpgme.NewData()
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.Decrypt(cipher, plain)
+	plain.Seek(0, gpgme.SeekSet)
+	return plain, err
+}
+
+// streamDecrypter writes the plain text to w as it comes, Gpgme does it so
+// that the limits stop gpg instead of checking what it has already done.
+type streamDecrypter interface {
+	decryptTo(w io.Writer, r io.Reader) error
+}
+
+// decryptTo is Decrypt() without keeping anything in memory
+func (g Gpgme) decryptTo(w io.Writer, r io.Reader) error {
+	ctx, err := g.context()
+	if err != nil {
+		return err
+	}
+	defer ctx.Release()
+
+	cipher, err := gpgme.NewDataReader(r)
+	if err != nil {
+		return err
+	}
+	defer cipher.Close()
+
+	plain, err := gpgme.NewDataWriter(w)
+	if err != nil {
+		return err
+	}
+	defer plain.Close()
+
+	return ctx.Decrypt(cipher, plain)
 }
 
 // NullGPG is for testing
@@ -43,21 +124,30 @@ func (NullGPG) Decrypt(r io.Reader) (*gpgme.Data, error) {
 type Gpg struct {
 	fn  string
 	unc string
+	r   io.Reader
 	gpg Decrypter
+	lim Limits
+	log Logger
 }
 
 // NewGpgfile initializes the struct and check filename
-func NewGpgfile(fn string) (*Gpg, error) {
+func NewGpgfile(fn string, opts ...Option) (*Gpg, error) {
+	o := newOptions(opts)
+
 	// Strip .gpg or .asc from filename
-	base := filepath.Base(fn)
-	pc := strings.Split(base, ".")
-	unc := strings.Join(pc[0:len(pc)-1], ".")
+	unc := uncName(fn)
 
-	return &Gpg{fn: fn, unc: unc, gpg: Gpgme{}}, nil
+	return &Gpg{fn: fn, unc: unc, gpg: o.gpg, lim: o.lim, log: o.log}, nil
 }
 
 // Extract binds it to the Archiver interface
 func (a Gpg) Extract(t string) ([]byte, error) {
+	// Stream given to NewFromReader
+	if a.r != nil {
+		verbose(a.log, "decrypting", Field{"archive", "-"})
+		return a.decrypt(a.r)
+	}
+
 	// Carefully open the box
 	fh, err := os.Open(a.fn)
 	if err != nil {
@@ -65,22 +155,72 @@ func (a Gpg) Extract(t string) ([]byte, error) {
 	}
 	defer fh.Close()
 
+	verbose(a.log, "decrypting", Field{"archive", a.fn})
+
+	return a.decrypt(fh)
+}
+
+// decrypt reads the plain text within our limits, the ratio is against what
+// was read from r.
+func (a Gpg) decrypt(r io.Reader) ([]byte, error) {
+	in := &counter{r: r}
+	return decrypt(a.gpg, in, newGuard(a.lim, in), a.unc)
+}
+
+// decryptReader runs r through the decrypter, giving back a stream.  gpgme
+// writes into a pipe so closing it stops the decryption.
+func decryptReader(gpg Decrypter, r io.Reader) (io.ReadCloser, error) {
+	if sd, ok := gpg.(streamDecrypter); ok {
+		pr, pw := io.Pipe()
+		go func() {
+			if err := sd.decryptTo(pw, r); err != nil {
+				pw.CloseWithError(errors.Wrap(&kindError{kind: ErrDecrypt, err: err}, "decrypt"))
+				return
+			}
+			pw.Close()
+		}()
+		return pr, nil
+	}
+
+	plain, err := gpg.Decrypt(r)
+	if err != nil {
+		return nil, errors.Wrap(&kindError{kind: ErrDecrypt, err: err}, "decrypt")
+	}
+	return plain, nil
+}
+
+// decrypt runs r through the decrypter and returns the plain text, checked
+// by g as name
+func decrypt(gpg Decrypter, r io.Reader, g *guard, name string) ([]byte, error) {
 	var buf bytes.Buffer
 
+	// gpgme is stopped as soon as a limit is reached
+	if sd, ok := gpg.(streamDecrypter); ok {
+		w := g.writer(name, &buf, -1)
+		err := sd.decryptTo(w, r)
+		if w.err != nil {
+			return []byte{}, w.err
+		}
+		if err != nil {
+			return []byte{}, errors.Wrap(&kindError{kind: ErrDecrypt, err: err}, "extract/decrypt")
+		}
+		return buf.Bytes(), nil
+	}
+
 	// Do the decryption thing
-	plain, err := a.gpg.Decrypt(fh)
+	plain, err := gpg.Decrypt(r)
 	if err != nil {
-		return []byte{}, errors.Wrap(err, "extract/decrypt")
+		return []byte{}, errors.Wrap(&kindError{kind: ErrDecrypt, err: err}, "extract/decrypt")
 	}
 	defer plain.Close()
 
 	// Save "plain" text
-
-	verbose("Decrypting %s", a.fn)
-
-	_, err = io.Copy(&buf, plain)
+	_, err = io.Copy(&buf, g.reader(name, plain, -1))
+	if errors.Is(err, ErrLimitExceeded) {
+		return []byte{}, err
+	}
 	if err != nil {
-		return []byte{}, errors.Wrap(err, "extract/copy")
+		return []byte{}, errors.Wrap(&kindError{kind: ErrDecrypt, err: err}, "extract/copy")
 	}
 
 	return buf.Bytes(), err
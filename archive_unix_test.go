@@ -4,6 +4,7 @@
 package archive
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,6 +12,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/proglottis/gpgme"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -28,8 +30,22 @@ func (NullGPGError) Decrypt(r io.Reader) (*gpgme.Data, error) {
 	return gb, ErrFakeGPGError
 }
 
+// streamGPG is NullGPG writing the plain text like Gpgme does, written is
+// how much was taken before the limits stopped it
+type streamGPG struct {
+	NullGPG
+	written *int64
+}
+
+func (g streamGPG) decryptTo(w io.Writer, r io.Reader) error {
+	n, err := io.Copy(w, r)
+	*g.written = n
+	return err
+}
+
 func TestNullGPG_Decrypt(t *testing.T) {
-	fVerbose = true
+	SetVerbose()
+	defer Reset()
 
 	gpg := NullGPG{}
 
@@ -51,7 +67,8 @@ func TestNullGPG_Decrypt(t *testing.T) {
 }
 
 func TestNullGPGError_Decrypt(t *testing.T) {
-	fVerbose = true
+	SetVerbose()
+	defer Reset()
 
 	gpg := NullGPGError{}
 
@@ -73,7 +90,8 @@ func TestNullGPGError_Decrypt(t *testing.T) {
 }
 
 func TestGpg_Decrypt(t *testing.T) {
-	fVerbose = true
+	SetVerbose()
+	defer Reset()
 
 	gpg := Gpgme{}
 
@@ -139,7 +157,7 @@ func TestGpg_Extract4(t *testing.T) {
 
 func TestGpg_Extract4_Debug(t *testing.T) {
 	fn := "testdata/notempty.zip.asc"
-	fDebug = true
+	SetDebug()
 
 	a := &Gpg{fn: fn, unc: "notempty.zip", gpg: NullGPG{}}
 	defer a.Close()
@@ -151,7 +169,37 @@ func TestGpg_Extract4_Debug(t *testing.T) {
 	zip, err := a.Extract(".zip")
 	assert.NoError(t, err)
 	assert.Equal(t, string(rh), string(zip))
-	fDebug = false
+	Reset()
+}
+
+func TestGpg_Extract_FromReader(t *testing.T) {
+	fh, err := os.Open("testdata/notempty.asc")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	a, err := NewFromReader(fh, ArchiveGpg)
+	require.NoError(t, err)
+	require.IsType(t, (*Gpg)(nil), a)
+
+	a.(*Gpg).gpg = NullGPG{}
+
+	txt, err := a.Extract(".txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+}
+
+func TestGpg_Extract_FromReaderError(t *testing.T) {
+	fh, err := os.Open("testdata/notempty.asc")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	a, err := NewFromReader(fh, ArchiveGpg)
+	require.NoError(t, err)
+
+	a.(*Gpg).gpg = NullGPGError{}
+
+	_, err = a.Extract(".txt")
+	assert.Error(t, err)
 }
 
 func TestGpg_Close(t *testing.T) {
@@ -160,3 +208,45 @@ func TestGpg_Close(t *testing.T) {
 	a := &Gpg{fn: fn, unc: "notempty.txt", gpg: NullGPG{}}
 	require.NoError(t, a.Close())
 }
+
+func TestGpg_StreamLimits(t *testing.T) {
+	var written int64
+
+	gpg := streamGPG{written: &written}
+	lim := Limits{MaxEntrySize: 1 << 20}
+
+	_, err := decrypt(gpg, bytes.NewReader(bomb), newGuard(lim, nil), "bomb")
+	requireLimit(t, err, "entry size")
+	assert.True(t, written <= 1<<20, "stopped at %d", written)
+
+	content, err := decrypt(gpg, bytes.NewReader(bomb), newGuard(Limits{}, nil), "bomb")
+	require.NoError(t, err)
+	assert.Len(t, content, len(bomb))
+
+	a, err := NewFromReader(bytes.NewReader(bomb), ArchiveGpg, WithDecrypter(gpg), WithLimits(lim))
+	require.NoError(t, err)
+
+	w, err := a.(Walkable).Walk()
+	require.NoError(t, err)
+	e, err := w.Next()
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(e)
+	requireLimit(t, err, "entry size")
+
+	// Closes the pipe, stopping the decryption
+	_, err = w.Next()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestGpg_StreamError(t *testing.T) {
+	fh, err := os.Open("testdata/notempty.asc")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	plain, err := decryptReader(Gpgme{}, fh)
+	require.NoError(t, err)
+	defer plain.Close()
+
+	_, err = ioutil.ReadAll(plain)
+	assert.True(t, errors.Is(err, ErrDecrypt), "%v", err)
+}
@@ -8,11 +8,10 @@
 package archive
 
 import (
+	"bytes"
 	"io"
 	"io/ioutil"
 	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -25,7 +24,10 @@ type Decrypter interface {
 }
 
 // Gpgme is for real gpgme stuff
-type Gpgme struct{}
+type Gpgme struct {
+	// Password is given to gpg instead of asking the agent, see WithPassword
+	Password string
+}
 
 // Decrypt does the obvious
 func (Gpgme) Decrypt(r io.Reader) ([]byte, error) {
@@ -44,21 +46,30 @@ func (NullGPG) Decrypt(r io.Reader) ([]byte, error) {
 type Gpg struct {
 	fn  string
 	unc string
+	r   io.Reader
 	gpg Decrypter
+	lim Limits
+	log Logger
 }
 
 // NewGpgfile initializes the struct and check filename
-func NewGpgfile(fn string) (*Gpg, error) {
+func NewGpgfile(fn string, opts ...Option) (*Gpg, error) {
+	o := newOptions(opts)
+
 	// Strip .gpg or .asc from filename
-	base := filepath.Base(fn)
-	pc := strings.Split(base, ".")
-	unc := strings.Join(pc[0:len(pc)-1], ".")
+	unc := uncName(fn)
 
-	return &Gpg{fn: fn, unc: unc, gpg: Gpgme{}}, nil
+	return &Gpg{fn: fn, unc: unc, gpg: o.gpg, lim: o.lim, log: o.log}, nil
 }
 
 // Extract binds it to the Archiver interface
 func (a Gpg) Extract(t string) ([]byte, error) {
+	// Stream given to NewFromReader
+	if a.r != nil {
+		verbose(a.log, "decrypting", Field{"archive", "-"})
+		return a.decrypt(a.r)
+	}
+
 	// Carefully open the box
 	fh, err := os.Open(a.fn)
 	if err != nil {
@@ -66,15 +77,37 @@ func (a Gpg) Extract(t string) ([]byte, error) {
 	}
 	defer fh.Close()
 
-	verbose("Decrypting %s", a.fn)
+	verbose(a.log, "decrypting", Field{"archive", a.fn})
+
+	return a.decrypt(fh)
+}
+
+// decrypt reads the plain text within our limits, the ratio is against what
+// was read from r.
+func (a Gpg) decrypt(r io.Reader) ([]byte, error) {
+	in := &counter{r: r}
+	return decrypt(a.gpg, in, newGuard(a.lim, in), a.unc)
+}
+
+// decryptReader runs r through the decrypter, giving back a stream
+func decryptReader(gpg Decrypter, r io.Reader) (io.ReadCloser, error) {
+	plain, err := gpg.Decrypt(r)
+	if err != nil {
+		return nil, errors.Wrap(&kindError{kind: ErrDecrypt, err: err}, "decrypt")
+	}
+	return ioutil.NopCloser(bytes.NewReader(plain)), nil
+}
 
+// decrypt runs r through the decrypter and returns the plain text, checked
+// by g as name
+func decrypt(gpg Decrypter, r io.Reader, g *guard, name string) ([]byte, error) {
 	// Do the decryption thing
-	plain, err := a.gpg.Decrypt(fh)
+	plain, err := gpg.Decrypt(r)
 	if err != nil {
-		return []byte{}, errors.Wrap(err, "extract/decrypt")
+		return []byte{}, errors.Wrap(&kindError{kind: ErrDecrypt, err: err}, "extract/decrypt")
 	}
 
-	return plain, err
+	return ioutil.ReadAll(g.reader(name, bytes.NewReader(plain), -1))
 }
 
 // Close is part of the Closer interface
@@ -0,0 +1,257 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cavaliergopher/cpio"
+	"github.com/pkg/errors"
+)
+
+// ------------------- cpio
+
+var (
+	magicCpio    = []byte("070701")
+	magicCpioCRC = []byte("070702")
+)
+
+// Cpio is for cpio archives in the "newc" format used by initramfs images
+// and RPM packages, compressed ones (.cpio.gz, etc.) too.  Like Tar it is
+// read sequentially.
+type Cpio struct {
+	fn  string
+	typ int
+	cfh *cpio.Reader
+	zfh io.Closer
+	fh  io.Closer
+	in  *counter
+	lim Limits
+	log Logger
+}
+
+// NewCpiofile opens a cpio file, WithType(ArchiveCpio|ArchiveGzip) forces the
+// compression.
+func NewCpiofile(fn string, opts ...Option) (*Cpio, error) {
+	o := newOptions(opts)
+
+	if fn == "-" {
+		return newCpio(fn, os.Stdin, o.typ&^ArchiveCpio, o)
+	}
+
+	fh, err := os.Open(fn)
+	if err != nil {
+		return &Cpio{}, errors.Wrap(err, "NewCpiofile")
+	}
+
+	typ := o.typ
+	if typ == 0 {
+		typ = guessType(fn, o.log)
+	}
+	c := typ &^ ArchiveCpio
+	if decompressor(c) == nil {
+		c = 0
+	}
+
+	a, err := newCpio(fn, fh, c, o)
+	if err != nil {
+		fh.Close()
+		return a, err
+	}
+	a.fh = fh
+	return a, nil
+}
+
+// newCpio puts a cpio reader over r, uncompressing it first if c is set
+func newCpio(fn string, r io.Reader, c int, o options) (*Cpio, error) {
+	if c == 0 {
+		return &Cpio{fn: fn, cfh: cpio.NewReader(r), lim: o.lim, log: o.log}, nil
+	}
+
+	zfh, in, err := uncompress(r, c)
+	if err != nil {
+		return &Cpio{}, errors.Wrap(err, "NewCpiofile/uncompress")
+	}
+	return &Cpio{fn: fn, typ: c, cfh: cpio.NewReader(zfh), zfh: zfh, in: in, lim: o.lim, log: o.log}, nil
+}
+
+// next reads the next header, with io.EOF after the trailer
+func (a Cpio) next() (*cpio.Header, error) {
+	hdr, err := a.cfh.Next()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read")
+	}
+
+	debug(a.log, "found", Field{"archive", a.fn}, Field{"member", hdr.Name})
+	return hdr, nil
+}
+
+// Extract returns the content of the first file whose name ends with t
+func (a Cpio) Extract(t string) ([]byte, error) {
+	g := newGuard(a.lim, a.in)
+	for {
+		hdr, err := a.next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return []byte{}, err
+		}
+
+		if err := g.add(hdr.Name, 1); err != nil {
+			return []byte{}, err
+		}
+
+		if hdr.FileInfo().Mode().IsRegular() && strings.HasSuffix(hdr.Name, t) {
+			var buf bytes.Buffer
+
+			n, err := io.Copy(&buf, g.reader(hdr.Name, a.cfh, -1))
+			if err != nil {
+				return []byte{}, errors.Wrap(err, "copy")
+			}
+			debug(a.log, "read", Field{"archive", a.fn}, Field{"member", hdr.Name}, Field{"bytes", n})
+			return buf.Bytes(), nil
+		}
+	}
+	return nil, notFound(a.fn, t)
+}
+
+// ExtractAll returns every file matching t in archive order, an empty t
+// matches all of them.
+func (a Cpio) ExtractAll(t string) ([]Member, error) {
+	var all []Member
+
+	g := newGuard(a.lim, a.in)
+	for {
+		hdr, err := a.next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return all, err
+		}
+
+		if err := g.add(hdr.Name, 1); err != nil {
+			return all, err
+		}
+
+		if !hdr.FileInfo().Mode().IsRegular() || !strings.HasSuffix(hdr.Name, t) {
+			continue
+		}
+
+		var buf bytes.Buffer
+
+		n, err := io.Copy(&buf, g.reader(hdr.Name, a.cfh, -1))
+		if err != nil {
+			return all, errors.Wrapf(err, "copy %s", hdr.Name)
+		}
+		debug(a.log, "read", Field{"archive", a.fn}, Field{"member", hdr.Name}, Field{"bytes", n})
+		all = append(all, Member{Name: hdr.Name, Data: buf.Bytes()})
+	}
+
+	if len(all) == 0 {
+		return all, notFound(a.fn, t)
+	}
+	return all, nil
+}
+
+// Close closes the decompressor and the file
+func (a Cpio) Close() error {
+	if a.zfh != nil {
+		a.zfh.Close()
+	}
+	if a.fh != nil {
+		return a.fh.Close()
+	}
+	return nil
+}
+
+// Type returns the archive type obviously, with the compression bit if any.
+func (a *Cpio) Type() int {
+	return ArchiveCpio | a.typ
+}
+
+// cpioInfo fills an EntryInfo from a cpio header
+func cpioInfo(hdr *cpio.Header) EntryInfo {
+	mode := hdr.FileInfo().Mode()
+
+	return EntryInfo{
+		Name:           hdr.Name,
+		Size:           hdr.Size,
+		CompressedSize: hdr.Size,
+		ModTime:        hdr.ModTime,
+		Mode:           mode,
+		Type:           kindOf(mode),
+		Linkname:       hdr.Linkname,
+	}
+}
+
+// List reads all headers.  Like Tar it can not be used afterwards.
+func (a Cpio) List() ([]EntryInfo, error) {
+	var list []EntryInfo
+
+	for {
+		hdr, err := a.next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return list, err
+		}
+
+		info := cpioInfo(hdr)
+		if a.typ != 0 {
+			info.CompressedSize = -1
+		}
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+type cpioWalker struct {
+	a Cpio
+	g *guard
+}
+
+// Walk returns a walker going through the stream
+func (a Cpio) Walk() (Walker, error) {
+	return &cpioWalker{a: a, g: newGuard(a.lim, a.in)}, nil
+}
+
+// Next reads the next header
+func (w *cpioWalker) Next() (*Entry, error) {
+	hdr, err := w.a.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.g.add(hdr.Name, 1); err != nil {
+		return nil, err
+	}
+	return &Entry{EntryInfo: cpioInfo(hdr), r: w.g.reader(hdr.Name, w.a.cfh, -1)}, nil
+}
+
+// ExtractTo writes every member under dir and returns the list of paths
+// created.  Names with "..", absolute ones and symlinks pointing outside dir
+// are rejected.
+func (a Cpio) ExtractTo(dir string, opts ExtractOptions) ([]string, error) {
+	w, err := a.Walk()
+	if err != nil {
+		return nil, err
+	}
+	return extractTo(a.log, w, dir, opts)
+}
+
+// SetLimits changes the limits for this archive
+func (a *Cpio) SetLimits(l Limits) {
+	a.lim = l
+}
+
+// SetLogger changes the logger for this archive
+func (a *Cpio) SetLogger(l Logger) {
+	a.log = l
+}
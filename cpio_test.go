@@ -0,0 +1,179 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewCpiofile(t *testing.T) {
+	a, err := New("testdata/notempty.cpio")
+	require.NoError(t, err)
+	require.IsType(t, (*Cpio)(nil), a)
+	defer a.Close()
+
+	assert.Equal(t, ArchiveCpio, a.Type())
+	assert.Implements(t, (*MultiExtracter)(nil), a)
+	assert.Implements(t, (*Lister)(nil), a)
+	assert.Implements(t, (*Walkable)(nil), a)
+	assert.Implements(t, (*DirExtracter)(nil), a)
+	assert.Implements(t, (*Limiter)(nil), a)
+	assert.Implements(t, (*Loggable)(nil), a)
+}
+
+func TestNewCpiofile_Bad(t *testing.T) {
+	_, err := NewCpiofile("/nonexistent")
+	assert.Error(t, err)
+
+	a, err := NewCpiofile("testdata/notempty.txt")
+	require.NoError(t, err)
+	_, err = a.Extract(".txt")
+	assert.Error(t, err)
+}
+
+func TestCpio_Extract(t *testing.T) {
+	a, err := NewCpiofile("testdata/notempty.cpio")
+	require.NoError(t, err)
+	defer a.Close()
+
+	xml, err := a.Extract(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, "<a/>\n", string(xml))
+
+	b, err := NewCpiofile("testdata/notempty.cpio")
+	require.NoError(t, err)
+	defer b.Close()
+
+	_, err = b.Extract(".json")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestCpio_Compressed(t *testing.T) {
+	a, err := New("testdata/notempty.cpio.gz")
+	require.NoError(t, err)
+	require.IsType(t, (*Cpio)(nil), a)
+	defer a.Close()
+
+	assert.Equal(t, ArchiveCpio|ArchiveGzip, a.Type())
+
+	txt, err := a.Extract("notempty.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+}
+
+func TestCpio_ExtractAll(t *testing.T) {
+	a, err := NewCpiofile("testdata/notempty.cpio")
+	require.NoError(t, err)
+	defer a.Close()
+
+	all, err := a.ExtractAll(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, []Member{
+		{Name: "notempty.txt", Data: []byte("this is a file\n")},
+		{Name: "other.txt", Data: []byte("another file\n")},
+		{Name: "empty.txt", Data: []byte{}},
+	}, all, "no symlink")
+}
+
+func TestCpio_List(t *testing.T) {
+	a, err := NewCpiofile("testdata/notempty.cpio.gz")
+	require.NoError(t, err)
+	defer a.Close()
+
+	list, err := a.List()
+	require.NoError(t, err)
+	require.Len(t, list, 6)
+
+	assert.Equal(t, "notempty.txt", list[0].Name)
+	assert.Equal(t, int64(15), list[0].Size)
+	assert.Equal(t, int64(-1), list[0].CompressedSize)
+	assert.Equal(t, EntryFile, list[0].Type)
+	assert.Equal(t, os.FileMode(0644), list[0].Mode)
+	assert.Equal(t, 2018, list[0].ModTime.Year())
+
+	assert.Equal(t, EntryDir, list[3].Type)
+	assert.Equal(t, EntrySymlink, list[5].Type)
+	assert.Equal(t, "notempty.txt", list[5].Linkname)
+}
+
+func TestCpio_Walk(t *testing.T) {
+	a, err := NewCpiofile("testdata/notempty.cpio")
+	require.NoError(t, err)
+	defer a.Close()
+
+	w, err := a.Walk()
+	require.NoError(t, err)
+
+	var names []string
+	for {
+		e, err := w.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, e.Name)
+
+		if e.Name == "sub/data.xml" {
+			xml, err := ioutil.ReadAll(e)
+			require.NoError(t, err)
+			assert.Equal(t, "<a/>\n", string(xml))
+		}
+	}
+	assert.Equal(t, []string{"notempty.txt", "other.txt", "empty.txt", "sub", "sub/data.xml", "link.txt"}, names)
+}
+
+func TestCpio_ExtractTo(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	a, err := NewCpiofile("testdata/notempty.cpio")
+	require.NoError(t, err)
+	defer a.Close()
+
+	files, err := a.ExtractTo(dir, ExtractOptions{})
+	require.NoError(t, err)
+	assert.Len(t, files, 6)
+
+	link, err := os.Readlink(filepath.Join(dir, "link.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "notempty.txt", link)
+}
+
+func TestCpio_Limits(t *testing.T) {
+	a, err := New("testdata/notempty.cpio", WithLimits(Limits{MaxEntries: 2}))
+	require.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.Extract(".xml")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestCpio_FromReader(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.cpio.gz")
+	require.NoError(t, err)
+
+	a, err := NewFromReader(bytes.NewReader(file), ArchiveCpio|ArchiveGzip)
+	require.NoError(t, err)
+	require.IsType(t, (*Cpio)(nil), a)
+	defer a.Close()
+
+	xml, err := a.Extract(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, "<a/>\n", string(xml))
+}
+
+func TestCpio_Nested(t *testing.T) {
+	a, err := OpenNested("testdata/notempty.cpio.gz")
+	require.NoError(t, err)
+
+	xml, err := a.Extract(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, "<a/>\n", string(xml))
+}
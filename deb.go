@@ -0,0 +1,206 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ------------------- Debian packages
+
+// A .deb is an ar archive with "debian-binary", "control.tar.*" for the
+// metadata and "data.tar.*" for the files, in that order.
+
+var magicDeb = []byte("!<arch>\ndebian-binary")
+
+// Deb is a Debian package, Extract() and the others work on the files in
+// data.tar like with Tar and Info() gives the content of the control file.
+type Deb struct {
+	*Tar
+	info PackageInfo
+}
+
+// NewDebfile opens the package and reads the control file
+func NewDebfile(fn string, opts ...Option) (*Deb, error) {
+	o := newOptions(opts)
+
+	fh, err := os.Open(fn)
+	if err != nil {
+		return &Deb{Tar: &Tar{}}, errors.Wrap(err, "NewDebfile")
+	}
+
+	a, err := newDeb(fn, fh, o)
+	if err != nil {
+		fh.Close()
+		return a, err
+	}
+	a.fh = fh
+	return a, nil
+}
+
+// NewDebFromReader reads the package from r
+func NewDebFromReader(r io.Reader, opts ...Option) (*Deb, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	return newDeb("-", r, newOptions(opts))
+}
+
+// newDeb reads the ar members up to data.tar
+func newDeb(fn string, r io.Reader, o options) (*Deb, error) {
+	afh, err := newArReader(r)
+	if err != nil {
+		return &Deb{Tar: &Tar{}}, errors.Wrap(err, "deb")
+	}
+
+	var (
+		info    PackageInfo
+		control bool
+	)
+
+	g := newGuard(o.lim, nil)
+	for {
+		hdr, err := afh.Next()
+		if err == io.EOF {
+			return &Deb{Tar: &Tar{}}, notFound(fn, "data.tar")
+		}
+		if err != nil {
+			return &Deb{Tar: &Tar{}}, errors.Wrap(err, "deb")
+		}
+
+		debug(o.log, "found", Field{"archive", fn}, Field{"member", hdr.Name})
+
+		if err := g.add(hdr.Name, 1); err != nil {
+			return &Deb{Tar: &Tar{}}, err
+		}
+
+		switch {
+		case hdr.Name == "debian-binary":
+			version, err := ioutil.ReadAll(g.reader(hdr.Name, afh, hdr.Size))
+			if err != nil {
+				return &Deb{Tar: &Tar{}}, errors.Wrap(err, "debian-binary")
+			}
+			if !bytes.HasPrefix(version, []byte("2.")) {
+				return &Deb{Tar: &Tar{}}, errors.Wrapf(ErrUnsupported, "deb format %q", bytes.TrimSpace(version))
+			}
+		case strings.HasPrefix(hdr.Name, "control.tar"):
+			c, err := debCompression(hdr.Name)
+			if err != nil {
+				return &Deb{Tar: &Tar{}}, err
+			}
+			info, err = debControl(fn, g.reader(hdr.Name, afh, hdr.Size), c, o)
+			if err != nil {
+				return &Deb{Tar: &Tar{}}, err
+			}
+			control = true
+		case strings.HasPrefix(hdr.Name, "data.tar"):
+			if !control {
+				return &Deb{Tar: &Tar{}}, notFound(fn, "control")
+			}
+			c, err := debCompression(hdr.Name)
+			if err != nil {
+				return &Deb{Tar: &Tar{}}, err
+			}
+			t, err := newTar(fn, afh, c, o)
+			if err != nil {
+				return &Deb{Tar: &Tar{}}, err
+			}
+			return &Deb{Tar: t, info: info}, nil
+		}
+	}
+}
+
+// debCompression returns the compression of control.tar.xz, data.tar.zst, etc.
+func debCompression(name string) (int, error) {
+	typ := Ext2Type(FullExt(name))
+	if !isTar(typ) {
+		return 0, errors.Wrapf(ErrUnsupported, "%s", name)
+	}
+	return typ &^ ArchiveTar, nil
+}
+
+// debControl looks for the control file, names are "./control" with
+// dpkg-deb and just "control" with some other tools.
+func debControl(fn string, r io.Reader, c int, o options) (PackageInfo, error) {
+	t, err := newTar(fn, r, c, o)
+	if err != nil {
+		return PackageInfo{}, errors.Wrap(err, "control.tar")
+	}
+	defer t.Close()
+
+	for {
+		hdr, err := t.tfh.Next()
+		if err == io.EOF {
+			return PackageInfo{}, notFound(fn, "control")
+		}
+		if err != nil {
+			return PackageInfo{}, errors.Wrap(err, "control.tar")
+		}
+		if path.Clean(hdr.Name) == "control" {
+			return parseControl(t.tfh)
+		}
+	}
+}
+
+// parseControl reads the fields we want from the control file, fields can be
+// folded over several lines starting with a space.
+func parseControl(r io.Reader) (PackageInfo, error) {
+	var (
+		info PackageInfo
+		name string
+	)
+
+	fields := map[string]string{}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := s.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if name == "" {
+				return info, errors.Errorf("bad control line %q", line)
+			}
+			fields[name] += " " + strings.TrimSpace(line)
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			return info, errors.Errorf("bad control line %q", line)
+		}
+		name = strings.ToLower(line[:i])
+		fields[name] = strings.TrimSpace(line[i+1:])
+	}
+	if err := s.Err(); err != nil {
+		return info, errors.Wrap(err, "control")
+	}
+
+	info.Name = fields["package"]
+	info.Version = fields["version"]
+	info.Arch = fields["architecture"]
+	for _, f := range []string{"pre-depends", "depends"} {
+		for _, d := range strings.Split(fields[f], ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				info.Depends = append(info.Depends, d)
+			}
+		}
+	}
+	return info, nil
+}
+
+// Type returns the archive type obviously.
+func (a *Deb) Type() int {
+	return ArchiveDeb
+}
+
+// Info returns the metadata from the control file
+func (a *Deb) Info() PackageInfo {
+	return a.info
+}
@@ -0,0 +1,157 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewDebfile(t *testing.T) {
+	a, err := New("testdata/hello_1.0-1_amd64.deb")
+	require.NoError(t, err)
+	require.IsType(t, (*Deb)(nil), a)
+	defer a.Close()
+
+	assert.Equal(t, ArchiveDeb, a.Type())
+	assert.Implements(t, (*Packager)(nil), a)
+	assert.Implements(t, (*MultiExtracter)(nil), a)
+	assert.Implements(t, (*Lister)(nil), a)
+	assert.Implements(t, (*Walkable)(nil), a)
+	assert.Implements(t, (*DirExtracter)(nil), a)
+	assert.Implements(t, (*Limiter)(nil), a)
+
+	assert.Equal(t, PackageInfo{
+		Name:    "hello",
+		Version: "1.0-1",
+		Arch:    "amd64",
+		Depends: []string{"libc6 (>= 2.14)", "adduser | passwd"},
+	}, a.(Packager).Info())
+}
+
+func TestNewDebfile_Bad(t *testing.T) {
+	_, err := NewDebfile("/nonexistent")
+	assert.Error(t, err)
+
+	_, err = NewDebfile("testdata/notempty.txt")
+	assert.Error(t, err)
+
+	_, err = NewDebfile("testdata/notempty.a")
+	assert.True(t, errors.Is(err, ErrNotFound), "no data.tar")
+
+	_, err = NewDebFromReader(nil)
+	assert.True(t, errors.Is(err, ErrNilReader))
+}
+
+func TestDeb_Extract(t *testing.T) {
+	a, err := NewDebfile("testdata/hello_1.0-1_amd64.deb")
+	require.NoError(t, err)
+	defer a.Close()
+
+	conf, err := a.Extract(".conf")
+	require.NoError(t, err)
+	assert.Equal(t, "greeting = hello\n", string(conf))
+}
+
+func TestDeb_ExtractAll(t *testing.T) {
+	a, err := NewDebfile("testdata/hello_1.0-1_amd64.deb")
+	require.NoError(t, err)
+	defer a.Close()
+
+	all, err := a.ExtractAll("")
+	require.NoError(t, err)
+	assert.Equal(t, []Member{
+		{Name: "./etc/hello/hello.conf", Data: []byte("greeting = hello\n")},
+		{Name: "./usr/share/doc/hello/README", Data: []byte("Hello\n")},
+	}, all)
+}
+
+func TestDeb_List(t *testing.T) {
+	a, err := NewDebfile("testdata/hello_1.0-1_amd64.deb")
+	require.NoError(t, err)
+	defer a.Close()
+
+	list, err := a.List()
+	require.NoError(t, err)
+	require.Len(t, list, 9)
+	assert.Equal(t, "./etc/hello/hello.conf", list[3].Name)
+	assert.Equal(t, int64(-1), list[3].CompressedSize)
+}
+
+func TestDeb_ExtractTo(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	a, err := NewDebfile("testdata/hello_1.0-1_amd64.deb")
+	require.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.ExtractTo(dir, ExtractOptions{})
+	require.NoError(t, err)
+
+	conf, err := ioutil.ReadFile(filepath.Join(dir, "etc", "hello", "hello.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "greeting = hello\n", string(conf))
+}
+
+func TestDeb_FromReader(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/hello_1.0-1_amd64.deb")
+	require.NoError(t, err)
+
+	typ, r, err := Detect(bytes.NewReader(file))
+	require.NoError(t, err)
+	assert.Equal(t, ArchiveDeb, typ)
+
+	a, err := NewFromReader(r, typ)
+	require.NoError(t, err)
+	defer a.Close()
+
+	assert.Equal(t, "hello", a.(Packager).Info().Name)
+
+	conf, err := a.Extract(".conf")
+	require.NoError(t, err)
+	assert.Equal(t, "greeting = hello\n", string(conf))
+}
+
+func TestParseControl(t *testing.T) {
+	control := `Package: foo
+Version: 1:2.3-1
+Architecture: all
+Pre-Depends: dpkg (>= 1.15)
+Depends: bar,
+ baz (<< 2)
+Description: short
+ long
+ .
+ Depends: not a field
+`
+	info, err := parseControl(strings.NewReader(control))
+	require.NoError(t, err)
+	assert.Equal(t, PackageInfo{
+		Name:    "foo",
+		Version: "1:2.3-1",
+		Arch:    "all",
+		Depends: []string{"dpkg (>= 1.15)", "bar", "baz (<< 2)"},
+	}, info)
+
+	_, err = parseControl(strings.NewReader("garbage\n"))
+	assert.Error(t, err)
+
+	_, err = parseControl(strings.NewReader(" continued\n"))
+	assert.Error(t, err)
+}
+
+func TestDeb_CloseOnError(t *testing.T) {
+	for _, fn := range []string{"testdata/notempty.a", "testdata/notempty.txt", "testdata/hello-1.0-1.x86_64.rpm"} {
+		a, err := New(fn, WithType(ArchiveDeb))
+		require.Error(t, err, fn)
+		assert.NoError(t, a.Close())
+		assert.Equal(t, ArchiveDeb, a.Type())
+	}
+}
@@ -0,0 +1,167 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ------------------- Detection
+
+// sniffLen is how much we look at, enough to cover the tar header
+const sniffLen = 512
+
+var (
+	magicZip      = []byte("PK\x03\x04")
+	magicZipEmpty = []byte("PK\x05\x06")
+	magicGzip     = []byte{0x1f, 0x8b}
+	magicZstd     = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicBzip2    = []byte("BZh")
+	magicXz       = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	magicLz4      = []byte{0x04, 0x22, 0x4d, 0x18}
+	magicSnappy   = []byte("\xff\x06\x00\x00sNaPpY")
+	magicCompress = []byte{0x1f, 0x9d}
+	magicTar      = []byte("ustar")
+	magicArmor    = []byte("-----BEGIN PGP ")
+)
+
+// tarMagicOffset is where "ustar" lives in a tar header
+const tarMagicOffset = 257
+
+// lzmaMaxDict is the largest dictionary lzma(1) can write (1.5 GB), past that
+// it is not an lzma file, whatever Limits.MaxDict says
+const lzmaMaxDict = 3 << 29
+
+// Detect looks at the first bytes of r and returns the archive type.  The
+// returned reader gives back the whole stream, including the bytes we had
+// to look at so it can be given to NewFromReader.  Anything not recognised
+// is ArchivePlain.
+func Detect(r io.Reader) (int, io.Reader, error) {
+	if r == nil {
+		return 0, nil, ErrNilReader
+	}
+	br := bufio.NewReaderSize(r, sniffLen)
+	buf, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return 0, br, errors.Wrap(err, "Detect")
+	}
+	return sniff(buf), br, nil
+}
+
+// sniff does the actual matching with the registered formats
+func sniff(buf []byte) int {
+	for _, f := range registered() {
+		if f.match(buf) {
+			return f.Type
+		}
+	}
+	return ArchivePlain
+}
+
+// isBzip2 checks the magic and the block size which is '1' to '9'
+func isBzip2(buf []byte) bool {
+	return len(buf) > len(magicBzip2) && bytes.HasPrefix(buf, magicBzip2) &&
+		buf[3] >= '1' && buf[3] <= '9'
+}
+
+// isLzma has to guess as there is no magic, only the properties (lc=3, lp=0,
+// pb=2 by default), the dictionary size which is 2^n or 2^n+2^(n-1) with
+// lzma(1) and the uncompressed size, unknown or not insanely large.  The
+// range coder always starts with a 0 too.
+func isLzma(buf []byte) bool {
+	if len(buf) < 14 || buf[0] != 0x5d || buf[13] != 0 {
+		return false
+	}
+	dict := binary.LittleEndian.Uint32(buf[1:5])
+	if dict < 1<<12 || dict > lzmaMaxDict {
+		return false
+	}
+	// Without its lowest bit, what is left is 0 or twice that bit
+	if rest := dict & (dict - 1); rest != 0 && rest != (dict-rest)<<1 {
+		return false
+	}
+	size := binary.LittleEndian.Uint64(buf[5:13])
+	return size == ^uint64(0) || size < 1<<38
+}
+
+// zlibProbe is how much isZlib uncompresses to be sure
+const zlibProbe = 4096
+
+// isZlib checks the header (deflate, no preset dictionary and the check bits)
+// but "x^" is valid text too so we also try to uncompress what we have.
+func isZlib(buf []byte) bool {
+	if len(buf) < 3 || buf[0]&0x0f != 8 || buf[0]>>4 > 7 || buf[1]&0x20 != 0 ||
+		(int(buf[0])<<8|int(buf[1]))%31 != 0 {
+		return false
+	}
+	_, err := io.CopyN(ioutil.Discard, flate.NewReader(bytes.NewReader(buf[2:])), zlibProbe)
+	return err == nil || err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// isPGPPacket checks whether buf starts with an OpenPGP packet that can begin
+// an encrypted or compressed message (RFC 4880, section 4.2).
+func isPGPPacket(buf []byte) bool {
+	if len(buf) < 2 || buf[0]&0x80 == 0 {
+		return false
+	}
+
+	var tag, hlen int
+
+	if buf[0]&0x40 != 0 {
+		// New format
+		tag = int(buf[0] & 0x3f)
+		switch l := buf[1]; {
+		case l < 192, l >= 224 && l < 255:
+			hlen = 2
+		case l < 224:
+			hlen = 3
+		default:
+			hlen = 6
+		}
+	} else {
+		// Old format
+		tag = int(buf[0]>>2) & 0x0f
+		hlen = [4]int{2, 3, 5, 1}[buf[0]&0x03]
+	}
+
+	if len(buf) <= hlen {
+		return false
+	}
+
+	// Check the packet version where we can
+	switch tag {
+	case 1: // Public-Key Encrypted Session Key
+		return buf[hlen] == 3
+	case 3: // Symmetric-Key Encrypted Session Key
+		return buf[hlen] == 4 || buf[hlen] == 5
+	case 8: // Compressed Data
+		return buf[hlen] <= 3
+	}
+	return false
+}
+
+// guessType looks at the content of fn first and use the extension only when
+// the content does not tell us anything or to find a tarball (or cpio
+// archive) behind the compression.
+func guessType(fn string, l Logger) int {
+	ext := Ext2Type(FullExt(fn))
+
+	fh, err := os.Open(fn)
+	if err != nil {
+		return ext
+	}
+	defer fh.Close()
+
+	typ, _, err := Detect(fh)
+	if err != nil || typ == ArchivePlain || ext == ArchiveTar|typ || ext == ArchiveCpio|typ {
+		return ext
+	}
+	debug(l, "detected", Field{"archive", fn}, Field{"type", typ})
+	return typ
+}
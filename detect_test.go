@@ -0,0 +1,160 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetect(t *testing.T) {
+	td := []struct {
+		fn  string
+		out int
+	}{
+		{"testdata/empty.txt", ArchivePlain},
+		{"testdata/notempty.txt", ArchivePlain},
+		{"testdata/notempty.zip", ArchiveZip},
+		{"testdata/notempty.7z", ArchiveSevenZip},
+		{"testdata/notempty.rar", ArchiveRar},
+		{"testdata/notempty-v4.rar", ArchiveRar},
+		{"testdata/notempty.txt.gz", ArchiveGzip},
+		{"testdata/notempty.txt.zst", ArchiveZstd},
+		{"testdata/notempty.txt.bz2", ArchiveBzip2},
+		{"testdata/notempty.txt.xz", ArchiveXz},
+		{"testdata/notempty.txt.lzma", ArchiveLzma},
+		{"testdata/notempty.txt.lz4", ArchiveLz4},
+		{"testdata/notempty.txt.sz", ArchiveSnappy},
+		{"testdata/notempty.txt.Z", ArchiveCompress},
+		{"testdata/notempty.txt.zlib", ArchiveZlib},
+		{"testdata/notempty.tar.zlib", ArchiveZlib},
+		{"testdata/notempty.tar", ArchiveTar},
+		{"testdata/notempty.cpio", ArchiveCpio},
+		{"testdata/notempty.cpio.gz", ArchiveGzip},
+		{"testdata/notempty.a", ArchiveAr},
+		{"testdata/hello_1.0-1_amd64.deb", ArchiveDeb},
+		{"testdata/hello-1.0-1.x86_64.rpm", ArchiveRpm},
+		{"testdata/empty.tar", ArchivePlain},
+	}
+
+	for _, d := range td {
+		file, err := ioutil.ReadFile(d.fn)
+		require.NoError(t, err)
+
+		typ, r, err := Detect(bytes.NewReader(file))
+		require.NoError(t, err, d.fn)
+		assert.Equal(t, d.out, typ, d.fn)
+
+		// We must get everything back
+		all, err := ioutil.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, file, all, d.fn)
+	}
+}
+
+func TestDetect_Nil(t *testing.T) {
+	_, _, err := Detect(nil)
+	require.Error(t, err)
+}
+
+func TestDetect_Gpg(t *testing.T) {
+	td := [][]byte{
+		[]byte("-----BEGIN PGP MESSAGE-----\n\nhQEMA...\n"),
+		[]byte("\n-----BEGIN PGP MESSAGE-----\n"),
+		{0x85, 0x01, 0x0c, 0x03, 0xde, 0xad},       // old format, PKESK v3
+		{0xc1, 0xc0, 0x4c, 0x03, 0xde, 0xad},       // new format, PKESK v3
+		{0x8c, 0x0d, 0x04, 0x07, 0x03, 0x02},       // old format, SKESK v4
+		{0xc3, 0x2e, 0x04, 0x09, 0x03, 0x08},       // new format, SKESK v4
+		{0xa3, 0x01, 0xed, 0xbd, 0x07, 0x60, 0x1c}, // old format, compressed
+	}
+
+	for _, d := range td {
+		typ, _, err := Detect(bytes.NewReader(d))
+		require.NoError(t, err)
+		assert.Equal(t, ArchiveGpg, typ, "%x", d)
+	}
+}
+
+func TestDetect_NotGpg(t *testing.T) {
+	td := [][]byte{
+		{0x85},
+		{0x85, 0x01, 0x0c, 0x07},
+		{0x8c, 0x0d, 0x01, 0x07},
+		{0xc2, 0x05, 0x04},
+		{0x7f, 0x45, 0x4c, 0x46},
+	}
+
+	for _, d := range td {
+		typ, _, err := Detect(bytes.NewReader(d))
+		require.NoError(t, err)
+		assert.Equal(t, ArchivePlain, typ, "%x", d)
+	}
+}
+
+func TestNew_Detect(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.txt.gz")
+	require.NoError(t, err)
+
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "report.dat")
+	require.NoError(t, ioutil.WriteFile(fn, file, 0644))
+
+	a, err := New(fn)
+	require.NoError(t, err)
+	require.IsType(t, (*Gzip)(nil), a)
+
+	txt, err := a.Extract(".txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+}
+
+func TestNewFromReader_Detect(t *testing.T) {
+	fh, err := os.Open("testdata/notempty.txt.zst")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	a, err := NewFromReader(fh, 0)
+	require.NoError(t, err)
+	require.Equal(t, ArchiveZstd, a.Type())
+
+	txt, err := a.Extract(".txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+}
+
+func TestIsLzma(t *testing.T) {
+	td := []struct {
+		in  string
+		out bool
+	}{
+		// lzma -9 and lzma -1
+		{"5d 00 00 00 04 ff ff ff ff ff ff ff ff 00", true},
+		{"5d 00 00 10 00 ff ff ff ff ff ff ff ff 00", true},
+		// 3 MB, 2^n+2^(n-1)
+		{"5d 00 00 30 00 0f 00 00 00 00 00 00 00 00", true},
+		{"5d 00 00 50 00 ff ff ff ff ff ff ff ff 00", false},
+		// 128 MB, past the default Limits.MaxDict but still lzma
+		{"5d 00 00 00 08 ff ff ff ff ff ff ff ff 00", true},
+		{"5d 00 00 00 80 ff ff ff ff ff ff ff ff 00", false},
+		{"5d 00 00 ff 7f ff ff ff ff ff ff ff ff ff", false},
+		{"5d 00 00 00 04 ff ff ff ff ff ff ff ff 01", false},
+		{"5d 00 00 00 04 00 00 00 00 00 01 00 00 00", false},
+		{"5d 00 00 00 04 ff ff ff ff ff ff ff ff", false},
+		{"5e 00 00 00 04 ff ff ff ff ff ff ff ff 00", false},
+	}
+
+	for _, d := range td {
+		buf, err := hex.DecodeString(strings.Replace(d.in, " ", "", -1))
+		require.NoError(t, err)
+		assert.Equal(t, d.out, isLzma(buf), d.in)
+	}
+}
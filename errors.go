@@ -0,0 +1,97 @@
+package archive
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ------------------- Errors
+
+// These can be checked with errors.Is(), even through the wrapping done by
+// github.com/pkg/errors.
+var (
+	// ErrNotFound is when no member matches
+	ErrNotFound = errors.New("not found")
+	// ErrWrongType is when the file is not what was asked for
+	ErrWrongType = errors.New("wrong file type")
+	// ErrUnsupported is for unknown types and compressions
+	ErrUnsupported = errors.New("not supported")
+	// ErrNilReader is when NewFromReader & co are given nothing
+	ErrNilReader = errors.New("nil reader")
+	// ErrLimitExceeded is when one of the Limits is reached, see LimitError
+	ErrLimitExceeded = errors.New("limit exceeded")
+	// ErrDecrypt is for everything going wrong with gpg, and for missing or
+	// wrong passwords
+	ErrDecrypt = errors.New("decryption failed")
+	// ErrUnsafePath is for members trying to escape from ExtractTo's directory
+	ErrUnsafePath = errors.New("unsafe path")
+	// ErrCorrupt is for headers making no sense, reported as such instead of
+	// crashing
+	ErrCorrupt = errors.New("corrupt archive")
+	// ErrNilWriter is when NewWriter is given nothing to write to
+	ErrNilWriter = errors.New("nil writer")
+	// ErrNoFilename is when New is given an empty file name
+	ErrNoFilename = errors.New("no file name")
+)
+
+// ArchiveError gives the context of an error
+type ArchiveError struct {
+	// Op is what we were doing
+	Op string
+	// Archive is the file name, "-" for streams
+	Archive string
+	// Member is the name of the member inside the archive, if any
+	Member string
+	Err    error
+}
+
+// Error implements the error interface
+func (e *ArchiveError) Error() string {
+	msg := e.Op
+	if e.Archive != "" {
+		msg += " " + e.Archive
+	}
+	if e.Member != "" {
+		msg += ":" + e.Member
+	}
+	if e.Err == nil {
+		return msg
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+// Unwrap is for errors.Is() and errors.As()
+func (e *ArchiveError) Unwrap() error {
+	return e.Err
+}
+
+// kindError ties one of our sentinels to the original error so that both
+// can be found with errors.Is() and errors.As().
+type kindError struct {
+	kind error
+	err  error
+}
+
+// Error implements the error interface
+func (e *kindError) Error() string {
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+// Is matches the sentinel
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// Unwrap gives the original error
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+// Is makes all LimitError match ErrLimitExceeded
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimitExceeded
+}
+
+// notFound is the common error when nothing matches t
+func notFound(fn, t string) error {
+	return &ArchiveError{Op: "extract", Archive: fn, Err: errors.Wrapf(ErrNotFound, "no file matching type %s", t)}
+}
@@ -0,0 +1,108 @@
+package archive
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveError_Error(t *testing.T) {
+	td := []struct {
+		e   ArchiveError
+		msg string
+	}{
+		{ArchiveError{Op: "extract", Err: ErrNotFound}, "extract: not found"},
+		{ArchiveError{Op: "extract", Archive: "foo.zip", Err: ErrNotFound}, "extract foo.zip: not found"},
+		{ArchiveError{Op: "open", Archive: "foo.zip", Member: "a.xml", Err: ErrNotFound}, "open foo.zip:a.xml: not found"},
+		{ArchiveError{Op: "open", Archive: "foo.zip"}, "open foo.zip"},
+	}
+
+	for _, d := range td {
+		assert.Equal(t, d.msg, d.e.Error())
+	}
+}
+
+func TestErrors_NotFound(t *testing.T) {
+	a, err := New("testdata/notempty.zip")
+	require.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.Extract(".xml")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.False(t, errors.Is(err, ErrWrongType))
+
+	var ae *ArchiveError
+	require.True(t, errors.As(err, &ae))
+	assert.Equal(t, "extract", ae.Op)
+	assert.Equal(t, "testdata/notempty.zip", ae.Archive)
+}
+
+func TestErrors_NotFoundTar(t *testing.T) {
+	a, err := New("testdata/notempty.tar.gz")
+	require.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.Extract(".xml")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestErrors_WrongType(t *testing.T) {
+	a, err := New("testdata/notempty.txt")
+	require.NoError(t, err)
+
+	_, err = a.Extract(".xml")
+	assert.True(t, errors.Is(err, ErrWrongType))
+}
+
+func TestErrors_NilReader(t *testing.T) {
+	_, err := NewFromReader(nil, ArchiveZip)
+	assert.True(t, errors.Is(err, ErrNilReader))
+
+	_, _, err = Detect(nil)
+	assert.True(t, errors.Is(err, ErrNilReader))
+
+	_, err = NewNestedFromReader(nil)
+	assert.True(t, errors.Is(err, ErrNilReader))
+}
+
+func TestErrors_Unsupported(t *testing.T) {
+	_, err := NewFromReader(bytes.NewBufferString("foo"), 666)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
+
+func TestErrors_Limit(t *testing.T) {
+	a, err := NewFromReader(bytes.NewReader(mkGzip(t, "bomb", bomb)), ArchiveGzip)
+	require.NoError(t, err)
+
+	a.(Limiter).SetLimits(Limits{MaxEntrySize: 1 << 20})
+	_, err = a.Extract("")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+
+	var le *LimitError
+	require.True(t, errors.As(err, &le))
+	assert.Equal(t, "entry size", le.Limit)
+}
+
+func TestErrors_Depth(t *testing.T) {
+	data := mkGzip(t, "", mkGzip(t, "", []byte(xmlReport)))
+
+	a, err := NewNestedFromReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	a.MaxDepth = 1
+
+	_, err = a.Extract(".xml")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestErrors_Decrypt(t *testing.T) {
+	orig := errors.New("no key")
+	err := errors.Wrap(&kindError{kind: ErrDecrypt, err: orig}, "extract/decrypt")
+
+	assert.True(t, errors.Is(err, ErrDecrypt))
+	assert.True(t, errors.Is(err, orig))
+	assert.Equal(t, "extract/decrypt: decryption failed: no key", err.Error())
+}
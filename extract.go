@@ -0,0 +1,274 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ------------------- Extraction to disk
+
+// ExtractOptions tunes ExtractTo
+type ExtractOptions struct {
+	// KeepMode restores permissions from the archive
+	KeepMode bool
+	// KeepTimes restores modification times from the archive
+	KeepTimes bool
+	// Overwrite allows replacing existing files
+	Overwrite bool
+}
+
+// DirExtracter is for archives able to recreate their tree on disk
+type DirExtracter interface {
+	ExtractTo(dir string, opts ExtractOptions) ([]string, error)
+}
+
+// maxLinkLen is the longest symlink target we accept from zip files
+const maxLinkLen = 4096
+
+// ExtractTo writes every member under dir and returns the list of paths
+// created.  Names with "..", absolute ones and symlinks pointing outside dir
+// are rejected.
+func (a Zip) ExtractTo(dir string, opts ExtractOptions) ([]string, error) {
+	w, err := a.Walk()
+	if err != nil {
+		return nil, err
+	}
+	return extractTo(a.log, w, dir, opts)
+}
+
+// ExtractTo writes every member under dir and returns the list of paths
+// created.  Names with "..", absolute ones and symlinks pointing outside dir
+// are rejected.
+func (a Tar) ExtractTo(dir string, opts ExtractOptions) ([]string, error) {
+	w, err := a.Walk()
+	if err != nil {
+		return nil, err
+	}
+	return extractTo(a.log, w, dir, opts)
+}
+
+// dirAttr is kept to set directory attributes at the end
+type dirAttr struct {
+	path string
+	info EntryInfo
+}
+
+// extractTo does the real work for every walker
+func extractTo(l Logger, w Walker, dir string, opts ExtractOptions) ([]string, error) {
+	var (
+		done []string
+		dirs []dirAttr
+	)
+
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "ExtractTo")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, errors.Wrap(err, "ExtractTo")
+	}
+
+	for {
+		e, err := w.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return done, err
+		}
+
+		target, err := safePath(root, e.Name)
+		if err != nil {
+			return done, err
+		}
+		if err := noSymlinkIn(root, filepath.Dir(target)); err != nil {
+			return done, err
+		}
+
+		verbose(l, "extracting", Field{"member", e.Name})
+
+		switch e.Type {
+		case EntryDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return done, errors.Wrapf(err, "mkdir %s", e.Name)
+			}
+			dirs = append(dirs, dirAttr{path: target, info: e.EntryInfo})
+		case EntryFile:
+			if err := writeFile(l, target, e, opts); err != nil {
+				return done, err
+			}
+		case EntrySymlink:
+			if err := writeSymlink(root, target, e, opts); err != nil {
+				return done, err
+			}
+		default:
+			debug(l, "skipping", Field{"member", e.Name})
+			continue
+		}
+		done = append(done, target)
+	}
+
+	// Directories last as writing files changes their mtime
+	for _, d := range dirs {
+		if err := setAttrs(d.path, d.info, opts); err != nil {
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+// safePath checks name and returns where it goes under root
+func safePath(root, name string) (string, error) {
+	fn := filepath.FromSlash(name)
+	if filepath.IsAbs(fn) || filepath.VolumeName(fn) != "" ||
+		strings.HasPrefix(fn, string(filepath.Separator)) || strings.HasPrefix(name, "/") {
+		return "", errors.Wrapf(ErrUnsafePath, "absolute path %s", name)
+	}
+
+	target := filepath.Join(root, fn)
+	if !within(root, target) {
+		return "", errors.Wrapf(ErrUnsafePath, "path %s outside of %s", name, root)
+	}
+	return target, nil
+}
+
+// within tells whether fn is root or below it
+func within(root, fn string) bool {
+	rel, err := filepath.Rel(root, fn)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// noSymlinkIn refuses to go through existing symlinks between root and dir
+func noSymlinkIn(root, dir string) error {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return err
+	}
+
+	cur := root
+	for _, p := range strings.Split(rel, string(filepath.Separator)) {
+		cur = filepath.Join(cur, p)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "lstat")
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return errors.Wrapf(ErrUnsafePath, "path %s goes through a symlink", dir)
+		}
+	}
+	return nil
+}
+
+// prepare creates the parent directory and removes the old file if allowed
+func prepare(target string, opts ExtractOptions) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return errors.Wrap(err, "mkdir")
+	}
+	if _, err := os.Lstat(target); err == nil {
+		if !opts.Overwrite {
+			return fmt.Errorf("%s already exists", target)
+		}
+		if err := os.Remove(target); err != nil {
+			return errors.Wrap(err, "remove")
+		}
+	}
+	return nil
+}
+
+// writeFile copies the entry content, never following an existing symlink
+func writeFile(l Logger, target string, e *Entry, opts ExtractOptions) error {
+	if err := prepare(target, opts); err != nil {
+		return err
+	}
+
+	fh, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return errors.Wrap(err, "create")
+	}
+
+	n, err := io.Copy(fh, e)
+	if err != nil {
+		fh.Close()
+		return errors.Wrapf(err, "copy %s", e.Name)
+	}
+	debug(l, "wrote", Field{"member", e.Name}, Field{"bytes", n})
+
+	if err := fh.Close(); err != nil {
+		return errors.Wrap(err, "close")
+	}
+	return setAttrs(target, e.EntryInfo, opts)
+}
+
+// writeSymlink checks the link does not escape from root before creating it
+func writeSymlink(root, target string, e *Entry, opts ExtractOptions) error {
+	link := e.Linkname
+	if link == "" {
+		// zip stores the target as content
+		buf, err := ioutil.ReadAll(io.LimitReader(e, maxLinkLen))
+		if err != nil {
+			return errors.Wrapf(err, "read %s", e.Name)
+		}
+		link = string(buf)
+	}
+
+	if filepath.IsAbs(link) || strings.HasPrefix(link, "/") {
+		return errors.Wrapf(ErrUnsafePath, "symlink %s -> %s is absolute", e.Name, link)
+	}
+
+	// Resolve one component at a time, ".." after a symlink is not what
+	// filepath.Clean thinks it is.
+	cur := filepath.Dir(target)
+	parts := strings.Split(filepath.ToSlash(link), "/")
+	for i, p := range parts {
+		switch p {
+		case "", ".":
+			continue
+		case "..":
+			cur = filepath.Dir(cur)
+		default:
+			cur = filepath.Join(cur, p)
+		}
+		if !within(root, cur) {
+			return errors.Wrapf(ErrUnsafePath, "symlink %s -> %s outside of %s", e.Name, link, root)
+		}
+		if i == len(parts)-1 {
+			break
+		}
+		if fi, err := os.Lstat(cur); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return errors.Wrapf(ErrUnsafePath, "symlink %s -> %s goes through a symlink", e.Name, link)
+		}
+	}
+
+	if err := prepare(target, opts); err != nil {
+		return err
+	}
+	return errors.Wrap(os.Symlink(link, target), "symlink")
+}
+
+// setAttrs restores mode and times if asked to
+func setAttrs(target string, info EntryInfo, opts ExtractOptions) error {
+	if opts.KeepMode {
+		if err := os.Chmod(target, info.Mode.Perm()); err != nil {
+			return errors.Wrap(err, "chmod")
+		}
+	}
+	if opts.KeepTimes && !info.ModTime.IsZero() {
+		if err := os.Chtimes(target, time.Now(), info.ModTime); err != nil {
+			return errors.Wrap(err, "chtimes")
+		}
+	}
+	return nil
+}
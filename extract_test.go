@@ -0,0 +1,222 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mkTarHeaders builds a tar with arbitrary headers, content is the name
+func mkTarHeaders(t *testing.T, hdrs ...*tar.Header) *Tar {
+	var buf bytes.Buffer
+
+	w := tar.NewWriter(&buf)
+	for _, hdr := range hdrs {
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(hdr.Name))
+		}
+		require.NoError(t, w.WriteHeader(hdr))
+		if hdr.Typeflag == tar.TypeReg {
+			_, err := w.Write([]byte(hdr.Name))
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, w.Close())
+
+	a, err := NewFromReader(&buf, ArchiveTar)
+	require.NoError(t, err)
+	return a.(*Tar)
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	return dir
+}
+
+func TestExtractTo_Tar(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	a, err := New("testdata/notempty.tar.gz")
+	require.NoError(t, err)
+	require.Implements(t, (*DirExtracter)(nil), a)
+	defer a.Close()
+
+	done, err := a.(DirExtracter).ExtractTo(dir, ExtractOptions{KeepTimes: true})
+	require.NoError(t, err)
+	require.Len(t, done, 2)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "notempty.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(content))
+
+	fi, err := os.Stat(filepath.Join(dir, "notempty.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, 2018, fi.ModTime().Year())
+}
+
+func TestExtractTo_Zip(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	file := mkZip(t, member{"a/", nil}, member{"a/b/c.xml", []byte("<c/>")}, member{"d.txt", []byte("d")})
+
+	a, err := NewZipFromReaderAt(bytes.NewReader(file), int64(len(file)))
+	require.NoError(t, err)
+
+	done, err := a.ExtractTo(filepath.Join(dir, "new"), ExtractOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "new", "a"),
+		filepath.Join(dir, "new", "a", "b", "c.xml"),
+		filepath.Join(dir, "new", "d.txt"),
+	}, done)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "new", "a", "b", "c.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, "<c/>", string(content))
+
+	// Not twice
+	_, err = a.ExtractTo(filepath.Join(dir, "new"), ExtractOptions{})
+	require.Error(t, err)
+
+	_, err = a.ExtractTo(filepath.Join(dir, "new"), ExtractOptions{Overwrite: true})
+	require.NoError(t, err)
+}
+
+func TestExtractTo_ZipSlip(t *testing.T) {
+	td := []string{
+		"../evil.txt",
+		"a/../../evil.txt",
+		"/tmp/evil.txt",
+	}
+
+	for _, d := range td {
+		dir := tempDir(t)
+
+		file := mkZip(t, member{d, []byte("evil")})
+		a, err := NewZipFromReaderAt(bytes.NewReader(file), int64(len(file)))
+		require.NoError(t, err)
+
+		done, err := a.ExtractTo(filepath.Join(dir, "root"), ExtractOptions{})
+		require.Error(t, err, d)
+		assert.Empty(t, done)
+
+		_, err = os.Stat(filepath.Join(dir, "evil.txt"))
+		assert.True(t, os.IsNotExist(err))
+		os.RemoveAll(dir)
+	}
+}
+
+func TestExtractTo_ZipSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no symlinks")
+	}
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+
+	w := zip.NewWriter(&buf)
+	hdr := &zip.FileHeader{Name: "link"}
+	hdr.SetMode(os.ModeSymlink | 0777)
+	fh, err := w.CreateHeader(hdr)
+	require.NoError(t, err)
+	_, err = fh.Write([]byte("../../etc"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	a, err := NewZipFromReader(&buf)
+	require.NoError(t, err)
+
+	_, err = a.ExtractTo(dir, ExtractOptions{})
+	require.Error(t, err)
+
+	_, err = os.Lstat(filepath.Join(dir, "link"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExtractTo_Symlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no symlinks")
+	}
+
+	td := []struct {
+		name string
+		hdrs []*tar.Header
+		ok   bool
+	}{
+		{"inside", []*tar.Header{
+			{Name: "a.txt", Typeflag: tar.TypeReg, Mode: 0644},
+			{Name: "d/b.txt", Typeflag: tar.TypeSymlink, Linkname: "../a.txt"},
+		}, true},
+		{"absolute", []*tar.Header{
+			{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+		}, false},
+		{"escape", []*tar.Header{
+			{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: "../../x"},
+		}, false},
+		{"through link", []*tar.Header{
+			{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "."},
+			{Name: "l/x.txt", Typeflag: tar.TypeReg, Mode: 0644},
+		}, false},
+		{"dotdot after link", []*tar.Header{
+			{Name: "d/e/up", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+			{Name: "x", Typeflag: tar.TypeSymlink, Linkname: "d/e/up/.."},
+		}, false},
+	}
+
+	for _, d := range td {
+		dir := tempDir(t)
+
+		a := mkTarHeaders(t, d.hdrs...)
+		_, err := a.ExtractTo(filepath.Join(dir, "root"), ExtractOptions{})
+		if d.ok {
+			assert.NoError(t, err, d.name)
+		} else {
+			assert.Error(t, err, d.name)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestExtractTo_KeepMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix modes")
+	}
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	mtime := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	a := mkTarHeaders(t,
+		&tar.Header{Name: "bin/", Typeflag: tar.TypeDir, Mode: 0700, ModTime: mtime},
+		&tar.Header{Name: "bin/run", Typeflag: tar.TypeReg, Mode: 0750, ModTime: mtime},
+		&tar.Header{Name: "fifo", Typeflag: tar.TypeFifo, Mode: 0600},
+	)
+
+	done, err := a.ExtractTo(dir, ExtractOptions{KeepMode: true, KeepTimes: true})
+	require.NoError(t, err)
+	assert.Len(t, done, 2)
+
+	fi, err := os.Stat(filepath.Join(dir, "bin", "run"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0750), fi.Mode().Perm())
+	assert.True(t, mtime.Equal(fi.ModTime()))
+
+	fi, err = os.Stat(filepath.Join(dir, "bin"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), fi.Mode().Perm())
+	assert.True(t, mtime.Equal(fi.ModTime()))
+}
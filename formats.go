@@ -0,0 +1,512 @@
+package archive
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/pkg/errors"
+	"github.com/ulikunitz/xz"
+)
+
+// ------------------- Formats
+
+// Magic is a signature found at Offset in the content
+type Magic struct {
+	Offset int
+	Bytes  []byte
+}
+
+// Format describes one archive or compression format.  The built-in ones are
+// registered the same way, see RegisterFormat().
+type Format struct {
+	// Name is for humans: "zip", "gzip", etc.
+	Name string
+	// Extensions are the ones used by Ext2Type(), with the dot (".zip")
+	Extensions []string
+	// TarAliases are the short forms of ".tar<ext>" like ".tgz", only for
+	// compression formats
+	TarAliases []string
+	// Magic are the signatures looked for by Detect(), any of them matches
+	Magic []Magic
+	// Match is for formats where Magic is not enough, it gets the first
+	// bytes of the content
+	Match func(buf []byte) bool
+	// Type is the value returned by Type(), it must be a bit not used by
+	// another format, see NewType()
+	Type int
+	// Open is used by New()
+	Open func(fn string, opts ...Option) (ExtractCloser, error)
+	// OpenReader is used by NewFromReader()
+	OpenReader func(r io.Reader, opts ...Option) (ExtractCloser, error)
+	// Decompress is for compression formats, it makes ".tar<ext>" work
+	Decompress func(r io.Reader) (io.ReadCloser, error)
+	// Compress is the other way, it makes Create() work for the format and
+	// ".tar<ext>".  The level is from 1 to 9, 0 being the default.
+	Compress func(w io.Writer, level int) (io.WriteCloser, error)
+}
+
+// match checks the content against the signatures
+func (f Format) match(buf []byte) bool {
+	for _, m := range f.Magic {
+		if len(buf) >= m.Offset+len(m.Bytes) &&
+			bytes.Equal(buf[m.Offset:m.Offset+len(m.Bytes)], m.Bytes) {
+			return true
+		}
+	}
+	return f.Match != nil && f.Match(buf)
+}
+
+// registry has all known formats in registration order which is also the
+// order in which they are detected.
+var registry struct {
+	sync.RWMutex
+	formats []Format
+}
+
+// RegisterFormat adds f to the known formats, New(), NewFromReader(),
+// Detect() and Ext2Type() will use it.  It is meant to be called from init().
+func RegisterFormat(f Format) error {
+	if f.Name == "" {
+		return errors.New("format without a name")
+	}
+	if f.Type <= 0 || f.Type&(f.Type-1) != 0 {
+		return errors.Errorf("format %s: type %d is not a single bit", f.Name, f.Type)
+	}
+	if f.Open == nil && f.OpenReader == nil {
+		return errors.Errorf("format %s: no Open nor OpenReader", f.Name)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	for _, o := range registry.formats {
+		if o.Type == f.Type {
+			return errors.Errorf("format %s: type %d already used by %s", f.Name, f.Type, o.Name)
+		}
+		if o.Name == f.Name {
+			return errors.Errorf("format %s already registered", f.Name)
+		}
+	}
+	registry.formats = append(registry.formats, f)
+	return nil
+}
+
+// uncompress puts the decompressor for c over r, what is read from r is
+// counted for Limits.MaxRatio
+func uncompress(r io.Reader, c int) (io.ReadCloser, *counter, error) {
+	dec := decompressor(c)
+	if dec == nil {
+		return nil, nil, errors.Wrapf(ErrUnsupported, "compression %d", c)
+	}
+	in := &counter{r: r}
+	zfh, err := dec(in)
+	if err != nil {
+		return nil, nil, err
+	}
+	return zfh, in, nil
+}
+
+// Formats returns the list of registered formats
+func Formats() []Format {
+	list := registered()
+	return append([]Format(nil), list...)
+}
+
+// NewType returns a type not used by any registered format
+func NewType() int {
+	t := 1
+	for _, f := range registered() {
+		if f.Type >= t {
+			t = f.Type << 1
+		}
+	}
+	return t
+}
+
+// registered gives the current list, it is only ever appended to
+func registered() []Format {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.formats
+}
+
+// lookupFormat finds the format for t, compressed tarballs being tar and
+// compressed cpio archives cpio
+func lookupFormat(t int) (Format, bool) {
+	for _, ct := range containers {
+		if isContainer(t, ct.typ) {
+			t = ct.typ
+		}
+	}
+	for _, f := range registered() {
+		if f.Type == t {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// decompressor returns how to uncompress c, nil if c is not a compression
+// format
+func decompressor(c int) func(io.Reader) (io.ReadCloser, error) {
+	for _, f := range registered() {
+		if f.Type == c {
+			return f.Decompress
+		}
+	}
+	return nil
+}
+
+// compressor returns how to compress c, nil if we can not
+func compressor(c int) func(io.Writer, int) (io.WriteCloser, error) {
+	for _, f := range registered() {
+		if f.Type == c {
+			return f.Compress
+		}
+	}
+	return nil
+}
+
+// ------------------- Built-in formats
+
+func init() {
+	for _, f := range builtinFormats() {
+		if err := RegisterFormat(f); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// builtinFormats are registered first, in detection order
+func builtinFormats() []Format {
+	return []Format{
+		{
+			Name:       "zip",
+			Extensions: []string{".zip"},
+			Magic:      []Magic{{0, magicZip}, {0, magicZipEmpty}},
+			Type:       ArchiveZip,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewZipfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return NewZipFromReader(r, opts...)
+			},
+		},
+		{
+			Name:       "7z",
+			Extensions: []string{".7z"},
+			Magic:      []Magic{{0, magic7z}},
+			Type:       ArchiveSevenZip,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewSevenZipfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return NewSevenZipFromReader(r, opts...)
+			},
+		},
+		{
+			Name:       "rar",
+			Extensions: []string{".rar"},
+			Magic:      []Magic{{0, magicRar}},
+			Type:       ArchiveRar,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewRarfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return NewRarFromReader(r, opts...)
+			},
+		},
+		{
+			Name:       "gzip",
+			Extensions: []string{".gz"},
+			TarAliases: []string{".tgz"},
+			Magic:      []Magic{{0, magicGzip}},
+			Type:       ArchiveGzip,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewGzipfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				o := newOptions(opts)
+				return &Gzip{fn: "-", unc: "-", gfh: r, lim: o.lim, log: o.log}, nil
+			},
+			Decompress: func(r io.Reader) (io.ReadCloser, error) {
+				return gzip.NewReader(r)
+			},
+			Compress: func(w io.Writer, level int) (io.WriteCloser, error) {
+				return gzip.NewWriterLevel(w, flateLevel(level))
+			},
+		},
+		{
+			Name:       "zstd",
+			Extensions: []string{".zst"},
+			TarAliases: []string{".tzst"},
+			Magic:      []Magic{{0, magicZstd}},
+			Type:       ArchiveZstd,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewZstdfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				o := newOptions(opts)
+				return &Zstd{fn: "-", unc: "-", gfh: r, lim: o.lim, log: o.log}, nil
+			},
+			Decompress: func(r io.Reader) (io.ReadCloser, error) {
+				zfh, err := zstd.NewReader(r)
+				if err != nil {
+					return nil, err
+				}
+				return zfh.IOReadCloser(), nil
+			},
+			Compress: func(w io.Writer, level int) (io.WriteCloser, error) {
+				return zstd.NewWriter(w, zstd.WithEncoderLevel(zstdLevel(level)))
+			},
+		},
+		{
+			Name:       "bzip2",
+			Extensions: []string{".bz2", ".bz"},
+			TarAliases: []string{".tbz2", ".tbz"},
+			Match:      isBzip2,
+			Type:       ArchiveBzip2,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewBzip2file(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return &Bzip2{readStream(r, "bzip2", anyLimits(bzip2Reader), opts)}, nil
+			},
+			Decompress: bzip2Reader,
+		},
+		{
+			Name:       "xz",
+			Extensions: []string{".xz"},
+			TarAliases: []string{".txz"},
+			Magic:      []Magic{{0, magicXz}},
+			Type:       ArchiveXz,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewXzfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return &Xz{readStream(r, "xz", xzReader, opts)}, nil
+			},
+			Decompress: func(r io.Reader) (io.ReadCloser, error) {
+				return xzReader(r, Limits{})
+			},
+			Compress: func(w io.Writer, level int) (io.WriteCloser, error) {
+				return xz.NewWriter(w)
+			},
+		},
+		{
+			Name:       "lz4",
+			Extensions: []string{".lz4"},
+			Magic:      []Magic{{0, magicLz4}},
+			Type:       ArchiveLz4,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewLz4file(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return &Lz4{readStream(r, "lz4", anyLimits(lz4Reader), opts)}, nil
+			},
+			Decompress: lz4Reader,
+			Compress: func(w io.Writer, level int) (io.WriteCloser, error) {
+				if level < 0 || level >= len(lz4Levels) {
+					return nil, errors.Errorf("lz4: compression level %d not between 0 and 9", level)
+				}
+				zfh := lz4.NewWriter(w)
+				if err := zfh.Apply(lz4.CompressionLevelOption(lz4Levels[level])); err != nil {
+					return nil, err
+				}
+				return zfh, nil
+			},
+		},
+		{
+			Name:       "snappy",
+			Extensions: []string{".sz"},
+			Magic:      []Magic{{0, magicSnappy}},
+			Type:       ArchiveSnappy,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewSnappyfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return &Snappy{readStream(r, "snappy", anyLimits(snappyReader), opts)}, nil
+			},
+			Decompress: snappyReader,
+		},
+		{
+			Name:       "brotli",
+			Extensions: []string{".br"},
+			Type:       ArchiveBrotli,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewBrotlifile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return &Brotli{readStream(r, "brotli", anyLimits(brotliReader), opts)}, nil
+			},
+			Decompress: brotliReader,
+		},
+		{
+			Name:       "compress",
+			Extensions: []string{".Z"},
+			TarAliases: []string{".taZ"},
+			Magic:      []Magic{{0, magicCompress}},
+			Type:       ArchiveCompress,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewCompressfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return &Compress{readStream(r, "compress", anyLimits(compressReader), opts)}, nil
+			},
+			Decompress: compressReader,
+		},
+		{
+			Name:       "deflate",
+			Extensions: []string{".deflate"},
+			Type:       ArchiveDeflate,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewDeflatefile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return &Deflate{readStream(r, "deflate", anyLimits(deflateReader), opts)}, nil
+			},
+			Decompress: deflateReader,
+			Compress: func(w io.Writer, level int) (io.WriteCloser, error) {
+				return flate.NewWriter(w, flateLevel(level))
+			},
+		},
+		{
+			Name:       "tar",
+			Extensions: []string{".tar"},
+			Magic:      []Magic{{tarMagicOffset, magicTar}},
+			Type:       ArchiveTar,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewTarfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				o := newOptions(opts)
+				return newTar("-", r, o.typ&^ArchiveTar, o)
+			},
+		},
+		{
+			Name:       "cpio",
+			Extensions: []string{".cpio"},
+			Magic:      []Magic{{0, magicCpio}, {0, magicCpioCRC}},
+			Type:       ArchiveCpio,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewCpiofile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				o := newOptions(opts)
+				return newCpio("-", r, o.typ&^ArchiveCpio, o)
+			},
+		},
+		{
+			Name:       "deb",
+			Extensions: []string{".deb", ".udeb"},
+			Magic:      []Magic{{0, magicDeb}},
+			Type:       ArchiveDeb,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewDebfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return NewDebFromReader(r, opts...)
+			},
+		},
+		{
+			Name:       "rpm",
+			Extensions: []string{".rpm"},
+			Magic:      []Magic{{0, magicRpm}},
+			Type:       ArchiveRpm,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewRpmfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return NewRpmFromReader(r, opts...)
+			},
+		},
+		{
+			// The signature is at 32769, too far for Detect()
+			Name:       "iso9660",
+			Extensions: []string{".iso"},
+			Type:       ArchiveIso,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewIsofile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return NewIsoFromReader(r, opts...)
+			},
+		},
+		{
+			Name:       "ar",
+			Extensions: []string{".a", ".ar"},
+			Magic:      []Magic{{0, magicAr}},
+			Type:       ArchiveAr,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewArfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return NewArFromReader(r, opts...)
+			},
+		},
+		{
+			Name:       "gpg",
+			Extensions: []string{".asc", ".gpg"},
+			Match: func(buf []byte) bool {
+				return bytes.HasPrefix(bytes.TrimLeft(buf, " \t\r\n"), magicArmor) || isPGPPacket(buf)
+			},
+			Type: ArchiveGpg,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewGpgfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				o := newOptions(opts)
+				return &Gpg{fn: "-", unc: "-", r: r, gpg: o.gpg, lim: o.lim, log: o.log}, nil
+			},
+		},
+		{
+			Name:       "lzma",
+			Extensions: []string{".lzma"},
+			TarAliases: []string{".tlz"},
+			Match:      isLzma,
+			Type:       ArchiveLzma,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewLzmafile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return &Lzma{readStream(r, "lzma", lzmaReader, opts)}, nil
+			},
+			Decompress: func(r io.Reader) (io.ReadCloser, error) {
+				return lzmaReader(r, Limits{})
+			},
+		},
+		{
+			Name:       "zlib",
+			Extensions: []string{".zlib", ".zz"},
+			Match:      isZlib,
+			Type:       ArchiveZlib,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewZlibfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				return &Zlib{readStream(r, "zlib", anyLimits(zlibReader), opts)}, nil
+			},
+			Decompress: zlibReader,
+			Compress: func(w io.Writer, level int) (io.WriteCloser, error) {
+				return zlib.NewWriterLevel(w, flateLevel(level))
+			},
+		},
+		{
+			Name: "plain",
+			Type: ArchivePlain,
+			Open: func(fn string, opts ...Option) (ExtractCloser, error) {
+				return NewPlainfile(fn, opts...)
+			},
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				o := newOptions(opts)
+				return &Plain{Name: "-", r: r, log: o.log}, nil
+			},
+		},
+	}
+}
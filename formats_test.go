@@ -0,0 +1,207 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rot13 is an in-house "compression" format for the tests
+var (
+	magicRot13 = []byte("ROT13\n")
+	rot13Once  sync.Once
+	rot13Type  int
+)
+
+func rot13(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z':
+			c = 'a' + (c-'a'+13)%26
+		case c >= 'A' && c <= 'Z':
+			c = 'A' + (c-'A'+13)%26
+		}
+		out[i] = c
+	}
+	return out
+}
+
+func mkRot13(data []byte) []byte {
+	return append(append([]byte{}, magicRot13...), rot13(data)...)
+}
+
+type rot13Reader struct {
+	r io.Reader
+}
+
+func (r rot13Reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	copy(p, rot13(p[:n]))
+	return n, err
+}
+
+// Rot13 is the archive side
+type Rot13 struct {
+	r io.Reader
+}
+
+func (a Rot13) Extract(t string) ([]byte, error) {
+	return ioutil.ReadAll(a.r)
+}
+
+func (a Rot13) Close() error {
+	return nil
+}
+
+func (a Rot13) Type() int {
+	return rot13Type
+}
+
+func rot13Decompress(r io.Reader) (io.ReadCloser, error) {
+	hdr := make([]byte, len(magicRot13))
+	if _, err := io.ReadFull(r, hdr); err != nil || !bytes.Equal(hdr, magicRot13) {
+		return nil, ErrWrongType
+	}
+	return ioutil.NopCloser(rot13Reader{r}), nil
+}
+
+func registerRot13(t *testing.T) {
+	rot13Once.Do(func() {
+		rot13Type = NewType()
+		err := RegisterFormat(Format{
+			Name:       "rot13",
+			Extensions: []string{".rot"},
+			TarAliases: []string{".trot"},
+			Magic:      []Magic{{0, magicRot13}},
+			Type:       rot13Type,
+			OpenReader: func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+				rc, err := rot13Decompress(r)
+				return Rot13{r: rc}, err
+			},
+			Decompress: rot13Decompress,
+		})
+		require.NoError(t, err)
+	})
+}
+
+func TestRegisterFormat_Errors(t *testing.T) {
+	open := func(r io.Reader, opts ...Option) (ExtractCloser, error) {
+		return nil, nil
+	}
+
+	td := []Format{
+		{Type: NewType(), OpenReader: open},
+		{Name: "foo", Type: 0, OpenReader: open},
+		{Name: "foo", Type: 3, OpenReader: open},
+		{Name: "foo", Type: NewType()},
+		{Name: "foo", Type: ArchiveZip, OpenReader: open},
+		{Name: "zip", Type: NewType(), OpenReader: open},
+	}
+
+	n := len(Formats())
+	for _, f := range td {
+		assert.Error(t, RegisterFormat(f), "%v", f)
+	}
+	assert.Len(t, Formats(), n)
+}
+
+func TestFormats(t *testing.T) {
+	builtin := builtinFormats()
+	list := Formats()
+
+	// Built-in ones first, in order
+	require.True(t, len(list) >= len(builtin))
+	for i, f := range builtin {
+		assert.Equal(t, f.Name, list[i].Name)
+	}
+	assert.Equal(t, "zip", list[0].Name)
+	assert.Equal(t, "plain", list[len(builtin)-1].Name)
+}
+
+func TestNewType(t *testing.T) {
+	typ := NewType()
+	_, ok := lookupFormat(typ)
+	assert.False(t, ok)
+	assert.Zero(t, typ&(typ-1))
+}
+
+func TestRegisterFormat_Detect(t *testing.T) {
+	registerRot13(t)
+
+	typ, r, err := Detect(bytes.NewReader(mkRot13([]byte("hello"))))
+	require.NoError(t, err)
+	assert.Equal(t, rot13Type, typ)
+
+	a, err := NewFromReader(r, typ)
+	require.NoError(t, err)
+	assert.Equal(t, rot13Type, a.Type())
+
+	txt, err := a.Extract("")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(txt))
+}
+
+func TestRegisterFormat_Ext2Type(t *testing.T) {
+	registerRot13(t)
+
+	assert.Equal(t, rot13Type, Ext2Type(".rot"))
+	assert.Equal(t, ArchiveTar|rot13Type, Ext2Type(".tar.rot"))
+	assert.Equal(t, ArchiveTar|rot13Type, Ext2Type(".trot"))
+}
+
+func TestRegisterFormat_Tar(t *testing.T) {
+	registerRot13(t)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "foo.tar.rot")
+	tr := mkRot13(mkTar(t, member{"a.xml", []byte("<a/>")}))
+	require.NoError(t, ioutil.WriteFile(fn, tr, 0644))
+
+	a, err := New(fn)
+	require.NoError(t, err)
+	defer a.Close()
+	assert.Equal(t, ArchiveTar|rot13Type, a.Type())
+
+	xml, err := a.Extract(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, "<a/>", string(xml))
+}
+
+func TestRegisterFormat_ReaderOnly(t *testing.T) {
+	registerRot13(t)
+
+	// No Open so New() can not do anything with it
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "foo.rot")
+	require.NoError(t, ioutil.WriteFile(fn, mkRot13([]byte("hello")), 0644))
+
+	_, err := New(fn)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+}
+
+func TestRegisterFormat_Nested(t *testing.T) {
+	registerRot13(t)
+
+	zip := mkZip(t, member{"report.xml.rot", mkRot13([]byte(xmlReport))})
+
+	a, err := NewNestedFromReader(bytes.NewReader(zip))
+	require.NoError(t, err)
+
+	xml, err := a.Extract(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, xmlReport, string(xml))
+	assert.Equal(t, []Layer{{ArchiveZip, "-"}, {rot13Type, "report.xml.rot"}}, a.Layers())
+}
@@ -1,11 +1,31 @@
 module github.com/keltia/archive
 
-go 1.14
+go 1.20
 
 require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/klauspost/compress v1.10.10
-	github.com/pkg/errors v0.8.1
+	github.com/andybalholm/brotli v1.1.1
+	github.com/bodgit/sevenzip v1.6.0
+	github.com/cavaliergopher/cpio v1.0.1
+	github.com/cavaliergopher/rpm v1.2.0
+	github.com/klauspost/compress v1.17.9
+	github.com/nwaples/rardecode v1.1.3
+	github.com/pierrec/lz4/v4 v4.1.21
+	github.com/pkg/errors v0.9.1
 	github.com/proglottis/gpgme v0.1.1
-	github.com/stretchr/testify v1.3.0
+	github.com/stretchr/testify v1.9.0
+	github.com/ulikunitz/xz v0.5.15
+	go4.org v0.0.0-20200411211856-f5505b9728dd
+)
+
+require (
+	github.com/bodgit/plumbing v1.3.0 // indirect
+	github.com/bodgit/windows v1.0.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/hashicorp/errwrap v1.0.0 // indirect
+	github.com/hashicorp/go-multierror v1.1.1 // indirect
+	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519 // indirect
+	golang.org/x/text v0.20.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
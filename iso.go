@@ -0,0 +1,724 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// ------------------- ISO 9660
+
+// An ISO 9660 image has volume descriptors from sector 16, the primary one
+// and maybe a Joliet one (UCS-2 names) each pointing to its own directory
+// tree.  Rock Ridge adds POSIX names, modes and symlinks in the "system use"
+// area of the primary tree records.  Like libarchive we prefer Rock Ridge,
+// then Joliet and only then the plain ISO names ("README.TXT;1").
+
+const (
+	isoSector     = 2048
+	isoFirstVD    = 16
+	isoMaxVD      = 64
+	isoMaxDepth   = 64
+	isoMaxCE      = 16
+	isoMaxDir     = 1 << 24
+	isoRecordLen  = 33
+	isoFlagDir    = 0x02
+	isoFlagMulti  = 0x80
+	isoVDPrimary  = 1
+	isoVDSupp     = 2
+	isoVDEnd      = 255
+	isoRootRecord = 156
+)
+
+var (
+	magicIso = []byte("CD001")
+
+	errIsoCorrupt = errors.New("corrupt ISO 9660 image")
+)
+
+// isoExtent is one part of a file, big ones have several
+type isoExtent struct {
+	off  int64
+	size int64
+}
+
+// isoFile is one entry of the flattened tree
+type isoFile struct {
+	info    EntryInfo
+	extents []isoExtent
+}
+
+// Iso is for ISO 9660 images with Joliet and Rock Ridge extensions, the
+// whole tree is read when opening it.
+type Iso struct {
+	fn    string
+	r     io.ReaderAt
+	size  int64
+	fh    io.Closer
+	tmp   string
+	files []isoFile
+	lim   Limits
+	log   Logger
+}
+
+// NewIsofile opens the image and reads the tree
+func NewIsofile(fn string, opts ...Option) (*Iso, error) {
+	o := newOptions(opts)
+
+	fh, err := os.Open(fn)
+	if err != nil {
+		return &Iso{}, errors.Wrap(err, "NewIsofile")
+	}
+
+	fi, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		return &Iso{}, errors.Wrap(err, "NewIsofile")
+	}
+
+	a := &Iso{fn: fn, r: fh, size: fi.Size(), fh: fh, lim: o.lim, log: o.log}
+	if err := a.read(); err != nil {
+		fh.Close()
+		return &Iso{}, err
+	}
+	return a, nil
+}
+
+// NewIsoFromReaderAt uses r directly, without any buffering
+func NewIsoFromReaderAt(r io.ReaderAt, size int64, opts ...Option) (*Iso, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	o := newOptions(opts)
+
+	a := &Iso{fn: "-", r: r, size: size, lim: o.lim, log: o.log}
+	if err := a.read(); err != nil {
+		return &Iso{}, err
+	}
+	return a, nil
+}
+
+// NewIsoFromReader reads the whole stream like NewZipFromReader() as we need
+// random access too.
+func NewIsoFromReader(r io.Reader, opts ...Option) (*Iso, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	o := newOptions(opts)
+
+	ra, size, tmp, err := spool(r, "archive-*.iso", o.mem, o.log)
+	if err != nil {
+		return &Iso{}, errors.Wrap(err, "NewIsoFromReader")
+	}
+
+	a := &Iso{fn: "-", r: ra, size: size, lim: o.lim, log: o.log}
+	if tmp != nil {
+		a.fh, a.tmp = tmp, tmp.Name()
+	}
+	if err := a.read(); err != nil {
+		a.Close()
+		return &Iso{}, err
+	}
+	return a, nil
+}
+
+// read finds the volume descriptors and walks the best tree
+func (a *Iso) read() error {
+	var pvd, joliet []byte
+
+	for i := int64(isoFirstVD); i < isoFirstVD+isoMaxVD; i++ {
+		vd := make([]byte, isoSector)
+		if _, err := a.r.ReadAt(vd, i*isoSector); err != nil {
+			return errors.Wrap(errIsoCorrupt, "volume descriptor")
+		}
+		if !bytes.Equal(vd[1:6], magicIso) {
+			return errors.New("not an ISO 9660 image")
+		}
+		if vd[0] == isoVDEnd {
+			break
+		}
+		switch {
+		case vd[0] == isoVDPrimary && pvd == nil:
+			pvd = vd
+		case vd[0] == isoVDSupp && vd[88] == '%' && vd[89] == '/' &&
+			(vd[90] == '@' || vd[90] == 'C' || vd[90] == 'E'):
+			joliet = vd
+		}
+	}
+	if pvd == nil {
+		return errors.Wrap(errIsoCorrupt, "no primary volume descriptor")
+	}
+
+	w := &isoTree{a: a}
+
+	root, err := parseIsoRecord(pvd[isoRootRecord:])
+	if err != nil {
+		return errors.Wrap(err, "root directory")
+	}
+	w.rr, w.skip = a.rockRidge(root)
+
+	switch {
+	case w.rr:
+		debug(a.log, "using Rock Ridge", Field{"archive", a.fn})
+	case joliet != nil:
+		debug(a.log, "using Joliet", Field{"archive", a.fn})
+		w.joliet = true
+		if root, err = parseIsoRecord(joliet[isoRootRecord:]); err != nil {
+			return errors.Wrap(err, "Joliet root directory")
+		}
+	}
+	return w.walk(root, "", 0)
+}
+
+// rockRidge looks for the SUSP "SP" entry in the "." record of the root
+// directory which also gives how many bytes to skip in every system use area.
+func (a *Iso) rockRidge(root *isoRecord) (bool, int) {
+	buf := make([]byte, isoSector)
+	if _, err := a.r.ReadAt(buf, root.extent*isoSector); err != nil {
+		return false, 0
+	}
+	dot, err := parseIsoRecord(buf)
+	if err != nil {
+		return false, 0
+	}
+	su := dot.su
+	if len(su) >= 7 && su[0] == 'S' && su[1] == 'P' && su[4] == 0xbe && su[5] == 0xef {
+		return true, int(su[6])
+	}
+	return false, 0
+}
+
+// isoRecord is a directory record
+type isoRecord struct {
+	extent int64
+	size   int64
+	mtime  time.Time
+	flags  byte
+	name   []byte
+	su     []byte
+}
+
+// parseIsoRecord decodes the record at the start of buf
+func parseIsoRecord(buf []byte) (*isoRecord, error) {
+	if len(buf) < isoRecordLen || int(buf[0]) > len(buf) || buf[0] < isoRecordLen {
+		return nil, errIsoCorrupt
+	}
+	l, nl := int(buf[0]), int(buf[32])
+	if isoRecordLen+nl > l {
+		return nil, errIsoCorrupt
+	}
+
+	r := &isoRecord{
+		extent: int64(binary.LittleEndian.Uint32(buf[2:6])),
+		size:   int64(binary.LittleEndian.Uint32(buf[10:14])),
+		mtime:  isoTime(buf[18:25]),
+		flags:  buf[25],
+		name:   buf[isoRecordLen : isoRecordLen+nl],
+	}
+	// The system use area starts on an even offset
+	su := isoRecordLen + nl
+	if nl%2 == 0 {
+		su++
+	}
+	if su < l {
+		r.su = buf[su:l]
+	}
+	return r, nil
+}
+
+// isoTime converts the 7 bytes date, the last one being the offset from
+// GMT in 15 minutes units
+func isoTime(b []byte) time.Time {
+	if b[0] == 0 && b[1] == 0 && b[2] == 0 {
+		return time.Time{}
+	}
+	tz := time.FixedZone("", int(int8(b[6]))*15*60)
+	return time.Date(1900+int(b[0]), time.Month(b[1]), int(b[2]), int(b[3]), int(b[4]), int(b[5]), 0, tz)
+}
+
+// isoTree reads a directory tree, flattening it
+type isoTree struct {
+	a      *Iso
+	rr     bool
+	skip   int
+	joliet bool
+	dirs   []isoExtent // sectors of the directories already read
+	read   int64
+}
+
+// add appends f to the tree, checking Limits.MaxEntries now as a bad image
+// can have many more entries than its size suggests
+func (w *isoTree) add(f isoFile) error {
+	w.a.files = append(w.a.files, f)
+	if w.a.lim.MaxEntries > 0 && len(w.a.files) > w.a.lim.MaxEntries {
+		return &LimitError{Name: w.a.fn, Limit: "entries"}
+	}
+	return nil
+}
+
+// visit checks that dir does not overlap any directory already read and that
+// we do not read more than the whole image
+func (w *isoTree) visit(dir *isoRecord, prefix string) error {
+	if dir.size > isoMaxDir {
+		return errors.Wrapf(errIsoCorrupt, "directory %s is too large", prefix)
+	}
+
+	// Whole sectors, at least one
+	ext := isoExtent{off: dir.extent * isoSector, size: (dir.size + isoSector - 1) / isoSector * isoSector}
+	if ext.size == 0 {
+		ext.size = isoSector
+	}
+	for _, d := range w.dirs {
+		if ext.off < d.off+d.size && d.off < ext.off+ext.size {
+			return errors.Wrapf(errIsoCorrupt, "directory loop at %s", prefix)
+		}
+	}
+	w.dirs = append(w.dirs, ext)
+
+	w.read += ext.size
+	if w.read > w.a.size {
+		return errors.Wrapf(errIsoCorrupt, "directories larger than the image at %s", prefix)
+	}
+	return nil
+}
+
+// walk reads the directory and everything under it
+func (w *isoTree) walk(dir *isoRecord, prefix string, depth int) error {
+	if depth > isoMaxDepth {
+		return errors.Wrapf(errIsoCorrupt, "directory loop at %s", prefix)
+	}
+	if err := w.visit(dir, prefix); err != nil {
+		return err
+	}
+	buf := make([]byte, dir.size)
+	if _, err := w.a.r.ReadAt(buf, dir.extent*isoSector); err != nil {
+		return errors.Wrapf(errIsoCorrupt, "directory %s", prefix)
+	}
+
+	var (
+		cur  *isoFile
+		last []byte
+	)
+
+	for p := 0; p < len(buf); {
+		// Records do not cross sectors, the rest is zeroes
+		if buf[p] == 0 {
+			p = (p/isoSector + 1) * isoSector
+			continue
+		}
+		rec, err := parseIsoRecord(buf[p:])
+		if err != nil {
+			return errors.Wrapf(err, "directory %s", prefix)
+		}
+		p += int(buf[p])
+
+		// "." and ".."
+		if len(rec.name) == 1 && rec.name[0] <= 1 {
+			continue
+		}
+
+		// Never read past the image later
+		ext := isoExtent{off: rec.extent * isoSector, size: rec.size}
+		if rec.flags&isoFlagDir == 0 && ext.off+ext.size > w.a.size {
+			return errors.Wrapf(errIsoCorrupt, "%s%s is past the end of the image", prefix, w.name(rec.name))
+		}
+
+		// Next part of a multi-extent file, with the same name
+		if cur != nil {
+			if !bytes.Equal(rec.name, last) {
+				return errors.Wrapf(errIsoCorrupt, "%s: missing extent", cur.info.Name)
+			}
+			cur.extents = append(cur.extents, ext)
+			cur.info.Size += rec.size
+			cur.info.CompressedSize += rec.size
+			if rec.flags&isoFlagMulti == 0 {
+				if err := w.add(*cur); err != nil {
+					return err
+				}
+				cur = nil
+			}
+			continue
+		}
+
+		info := EntryInfo{
+			Name:    w.name(rec.name),
+			ModTime: rec.mtime,
+		}
+
+		if w.rr {
+			su, err := w.susp(rec.su)
+			if err != nil {
+				return errors.Wrapf(err, "directory %s", prefix)
+			}
+			if su.relocated {
+				continue
+			}
+			if su.name != "" {
+				info.Name = su.name
+			}
+			info.Mode = su.mode
+			if su.child >= 0 {
+				// Relocated directory, the real one is there
+				rec.flags |= isoFlagDir
+				buf := make([]byte, isoSector)
+				if _, err := w.a.r.ReadAt(buf, su.child*isoSector); err != nil {
+					return errors.Wrapf(errIsoCorrupt, "directory %s", info.Name)
+				}
+				if rec, err = parseIsoRecord(buf); err != nil {
+					return errors.Wrapf(err, "directory %s", info.Name)
+				}
+			}
+			info.Linkname = su.link
+		}
+
+		name := prefix + info.Name
+		if rec.flags&isoFlagDir != 0 {
+			if info.Mode == 0 {
+				info.Mode = 0755 | os.ModeDir
+			}
+			info.Name = name + "/"
+			info.Type = EntryDir
+			if err := w.add(isoFile{info: info}); err != nil {
+				return err
+			}
+
+			if err := w.walk(rec, info.Name, depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if info.Mode == 0 {
+			info.Mode = 0644
+		}
+		info.Name = name
+		info.Size, info.CompressedSize = rec.size, rec.size
+		info.Type = kindOf(info.Mode)
+
+		f := isoFile{info: info, extents: []isoExtent{ext}}
+		if rec.flags&isoFlagMulti != 0 {
+			cur, last = &f, rec.name
+			continue
+		}
+		if err := w.add(f); err != nil {
+			return err
+		}
+	}
+	if cur != nil {
+		return errors.Wrapf(errIsoCorrupt, "%s: missing extent", cur.info.Name)
+	}
+	return nil
+}
+
+// name converts the ISO or Joliet name, without the ";1" version
+func (w *isoTree) name(b []byte) string {
+	var name string
+
+	if w.joliet {
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			u[i] = binary.BigEndian.Uint16(b[2*i:])
+		}
+		name = string(utf16.Decode(u))
+	} else {
+		name = string(b)
+	}
+	if i := strings.LastIndexByte(name, ';'); i >= 0 {
+		name = name[:i]
+	}
+	return strings.TrimSuffix(name, ".")
+}
+
+// isoSUSP is what we use from the Rock Ridge entries
+type isoSUSP struct {
+	name      string
+	mode      os.FileMode
+	link      string
+	relocated bool
+	child     int64
+}
+
+// susp decodes the system use area, following the continuation areas
+func (w *isoTree) susp(area []byte) (isoSUSP, error) {
+	su := isoSUSP{child: -1}
+
+	if len(area) < w.skip {
+		return su, nil
+	}
+	area = area[w.skip:]
+
+	var comp bool
+
+	for ce := 0; ; {
+		var next *isoExtent
+
+		for len(area) >= 4 {
+			l := int(area[2])
+			if l < 4 || l > len(area) {
+				break
+			}
+			e := area[:l]
+			area = area[l:]
+
+			switch string(e[:2]) {
+			case "NM":
+				if l > 5 && e[4]&0x06 == 0 {
+					su.name += string(e[5:])
+				}
+			case "PX":
+				if l >= 12 {
+					su.mode = posixMode(binary.LittleEndian.Uint32(e[4:8]))
+				}
+			case "SL":
+				if l > 5 {
+					comp = isoSymlink(&su.link, e[5:], comp)
+				}
+			case "CE":
+				if l >= 28 {
+					next = &isoExtent{
+						off:  int64(binary.LittleEndian.Uint32(e[4:8]))*isoSector + int64(binary.LittleEndian.Uint32(e[12:16])),
+						size: int64(binary.LittleEndian.Uint32(e[20:24])),
+					}
+				}
+			case "CL":
+				if l >= 12 {
+					su.child = int64(binary.LittleEndian.Uint32(e[4:8]))
+				}
+			case "RE":
+				su.relocated = true
+			case "ST":
+				area = nil
+			}
+		}
+
+		if next == nil {
+			return su, nil
+		}
+		if ce++; ce > isoMaxCE || next.size > isoSector {
+			return su, errors.Wrap(errIsoCorrupt, "continuation area")
+		}
+		area = make([]byte, next.size)
+		if _, err := w.a.r.ReadAt(area, next.off); err != nil {
+			return su, errors.Wrap(errIsoCorrupt, "continuation area")
+		}
+	}
+}
+
+// isoSymlink adds the components of a SL entry to link, comp tells whether
+// the last component continues in the next entry.
+func isoSymlink(link *string, b []byte, comp bool) bool {
+	for len(b) >= 2 {
+		flags, l := b[0], int(b[1])
+		if 2+l > len(b) {
+			break
+		}
+
+		var part string
+		switch {
+		case flags&0x02 != 0:
+			part = "."
+		case flags&0x04 != 0:
+			part = ".."
+		case flags&0x08 != 0:
+			part = "/"
+		default:
+			part = string(b[2 : 2+l])
+		}
+
+		switch {
+		case comp, *link == "":
+		case strings.HasSuffix(*link, "/"):
+		default:
+			*link += "/"
+		}
+		*link += part
+		comp = flags&0x01 != 0
+		b = b[2+l:]
+	}
+	return comp
+}
+
+// posixMode converts st_mode
+func posixMode(m uint32) os.FileMode {
+	mode := os.FileMode(m & 0777)
+	switch m & 0170000 {
+	case 0040000:
+		mode |= os.ModeDir
+	case 0120000:
+		mode |= os.ModeSymlink
+	case 0100000:
+	default:
+		mode |= os.ModeIrregular
+	}
+	if m&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// isoMatch tells whether name is what we look for: a path if t has a '/' or
+// an extension/file name, ISO names being uppercase we ignore the case.
+func isoMatch(name, t string) bool {
+	if strings.Contains(t, "/") {
+		return strings.EqualFold(name, strings.TrimPrefix(t, "/"))
+	}
+	return strings.EqualFold(path.Ext(name), t) || strings.EqualFold(path.Base(name), t)
+}
+
+// content returns a reader over all the extents of f
+func (a Iso) content(f isoFile) io.Reader {
+	var parts []io.Reader
+
+	for _, e := range f.extents {
+		parts = append(parts, io.NewSectionReader(a.r, e.off, e.size))
+	}
+	return io.MultiReader(parts...)
+}
+
+// Extract returns the content of the first file matching t, either the
+// extension (".txt"), the name ("README.TXT") or the path ("doc/README.TXT")
+func (a Iso) Extract(t string) ([]byte, error) {
+	verbose(a.log, "exploring", Field{"archive", a.fn})
+
+	g := newGuard(a.lim, nil)
+	if err := g.add(a.fn, len(a.files)); err != nil {
+		return []byte{}, err
+	}
+
+	for _, f := range a.files {
+		verbose(a.log, "looking at", Field{"archive", a.fn}, Field{"member", f.info.Name})
+
+		if f.info.Type == EntryFile && isoMatch(f.info.Name, t) {
+			content, err := ioutil.ReadAll(g.reader(f.info.Name, a.content(f), f.info.Size))
+			if err != nil {
+				return []byte{}, errors.Wrapf(err, "read %s", f.info.Name)
+			}
+			return content, nil
+		}
+	}
+
+	return []byte{}, notFound(a.fn, t)
+}
+
+// ExtractAll returns every file matching t in image order, an empty t
+// matches all of them.
+func (a Iso) ExtractAll(t string) ([]Member, error) {
+	verbose(a.log, "exploring", Field{"archive", a.fn})
+
+	var all []Member
+
+	g := newGuard(a.lim, nil)
+	if err := g.add(a.fn, len(a.files)); err != nil {
+		return all, err
+	}
+
+	for _, f := range a.files {
+		verbose(a.log, "looking at", Field{"archive", a.fn}, Field{"member", f.info.Name})
+
+		if f.info.Type != EntryFile || (t != "" && !isoMatch(f.info.Name, t)) {
+			continue
+		}
+
+		content, err := ioutil.ReadAll(g.reader(f.info.Name, a.content(f), f.info.Size))
+		if err != nil {
+			return all, errors.Wrapf(err, "read %s", f.info.Name)
+		}
+		all = append(all, Member{Name: f.info.Name, Data: content})
+	}
+
+	if len(all) == 0 {
+		return all, notFound(a.fn, t)
+	}
+	return all, nil
+}
+
+// Close closes the file and removes the temporary file if any
+func (a Iso) Close() error {
+	if a.fh == nil {
+		return nil
+	}
+	err := a.fh.Close()
+	if a.tmp != "" {
+		os.Remove(a.tmp)
+	}
+	return err
+}
+
+// Type returns the archive type obviously.
+func (a Iso) Type() int {
+	return ArchiveIso
+}
+
+// List returns the tree, directories end with '/'
+func (a Iso) List() ([]EntryInfo, error) {
+	var list []EntryInfo
+
+	for _, f := range a.files {
+		list = append(list, f.info)
+	}
+	return list, nil
+}
+
+type isoWalker struct {
+	a     Iso
+	files []isoFile
+	g     *guard
+}
+
+// Walk returns a walker over the tree
+func (a Iso) Walk() (Walker, error) {
+	g := newGuard(a.lim, nil)
+	if err := g.add(a.fn, len(a.files)); err != nil {
+		return nil, err
+	}
+	return &isoWalker{a: a, files: a.files, g: g}, nil
+}
+
+// Next returns the next entry
+func (w *isoWalker) Next() (*Entry, error) {
+	if len(w.files) == 0 {
+		return nil, io.EOF
+	}
+
+	f := w.files[0]
+	w.files = w.files[1:]
+
+	verbose(w.a.log, "looking at", Field{"archive", w.a.fn}, Field{"member", f.info.Name})
+
+	return &Entry{EntryInfo: f.info, r: w.g.reader(f.info.Name, w.a.content(f), f.info.Size)}, nil
+}
+
+// ExtractTo writes every member under dir and returns the list of paths
+// created.  Names with "..", absolute ones and symlinks pointing outside dir
+// are rejected.
+func (a Iso) ExtractTo(dir string, opts ExtractOptions) ([]string, error) {
+	w, err := a.Walk()
+	if err != nil {
+		return nil, err
+	}
+	return extractTo(a.log, w, dir, opts)
+}
+
+// SetLimits changes the limits for this archive
+func (a *Iso) SetLimits(l Limits) {
+	a.lim = l
+}
+
+// SetLogger changes the logger for this archive
+func (a *Iso) SetLogger(l Logger) {
+	a.log = l
+}
@@ -0,0 +1,355 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// isoImage uncompresses one of the images, they are mostly zeroes
+func isoImage(t *testing.T, dir, name string) string {
+	fh, err := os.Open(filepath.Join("testdata", name+".gz"))
+	require.NoError(t, err)
+	defer fh.Close()
+
+	zfh, err := gzip.NewReader(fh)
+	require.NoError(t, err)
+
+	fn := filepath.Join(dir, name)
+	out, err := os.Create(fn)
+	require.NoError(t, err)
+	defer out.Close()
+
+	_, err = io.Copy(out, zfh)
+	require.NoError(t, err)
+	return fn
+}
+
+func TestNewIsofile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	a, err := New(isoImage(t, dir, "rr.iso"))
+	require.NoError(t, err)
+	require.IsType(t, (*Iso)(nil), a)
+	defer a.Close()
+
+	assert.Equal(t, ArchiveIso, a.Type())
+	assert.Implements(t, (*MultiExtracter)(nil), a)
+	assert.Implements(t, (*Lister)(nil), a)
+	assert.Implements(t, (*Walkable)(nil), a)
+	assert.Implements(t, (*DirExtracter)(nil), a)
+	assert.Implements(t, (*Limiter)(nil), a)
+	assert.Implements(t, (*Loggable)(nil), a)
+}
+
+func TestNewIsofile_Bad(t *testing.T) {
+	_, err := NewIsofile("/nonexistent")
+	assert.Error(t, err)
+
+	_, err = NewIsofile("testdata/notempty.txt")
+	assert.Error(t, err)
+
+	_, err = NewIsoFromReader(nil)
+	assert.True(t, errors.Is(err, ErrNilReader))
+
+	_, err = NewIsoFromReaderAt(nil, 0)
+	assert.True(t, errors.Is(err, ErrNilReader))
+}
+
+func TestIso_Names(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	td := []struct {
+		fn    string
+		names []string
+	}{
+		{"rr.iso", []string{"A Long Mixed-Case Name.text", "notempty.txt", "other.txt", "sub/", "sub/data.xml", "sub/deeper/", "sub/deeper/deep.csv"}},
+		{"joliet.iso", []string{"A Long Mixed-Case Name.text", "notempty.txt", "other.txt", "sub/", "sub/data.xml", "sub/deeper/", "sub/deeper/deep.csv"}},
+		{"plain.iso", []string{"A_LONG_M.TEX", "NOTEMPTY.TXT", "OTHER.TXT", "SUB/", "SUB/DATA.XML", "SUB/DEEPER/", "SUB/DEEPER/DEEP.CSV"}},
+	}
+
+	for _, d := range td {
+		a, err := NewIsofile(isoImage(t, dir, d.fn))
+		require.NoError(t, err, d.fn)
+
+		list, err := a.List()
+		require.NoError(t, err)
+
+		var names []string
+		for _, e := range list {
+			names = append(names, e.Name)
+		}
+		assert.Equal(t, d.names, names, d.fn)
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestIso_List(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	a, err := NewIsofile(isoImage(t, dir, "rr.iso"))
+	require.NoError(t, err)
+	defer a.Close()
+
+	list, err := a.List()
+	require.NoError(t, err)
+	require.Len(t, list, 7)
+
+	assert.Equal(t, "notempty.txt", list[1].Name)
+	assert.Equal(t, int64(15), list[1].Size)
+	assert.Equal(t, EntryFile, list[1].Type)
+	assert.Equal(t, os.FileMode(0444), list[1].Mode, "from Rock Ridge")
+	assert.Equal(t, 2018, list[1].ModTime.Year())
+
+	assert.Equal(t, EntryDir, list[3].Type)
+	assert.True(t, list[3].Mode.IsDir())
+}
+
+func TestIso_Extract(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	for _, fn := range []string{"rr.iso", "joliet.iso", "plain.iso"} {
+		a, err := NewIsofile(isoImage(t, dir, fn))
+		require.NoError(t, err)
+
+		xml, err := a.Extract(".xml")
+		require.NoError(t, err, fn)
+		assert.Equal(t, "<a/>\n", string(xml), fn)
+
+		csv, err := a.Extract("sub/deeper/deep.csv")
+		require.NoError(t, err, fn)
+		assert.Equal(t, "deep\n", string(csv), fn)
+
+		txt, err := a.Extract("/notempty.txt")
+		require.NoError(t, err, fn)
+		assert.Equal(t, "this is a file\n", string(txt), fn)
+
+		_, err = a.Extract(".json")
+		assert.True(t, errors.Is(err, ErrNotFound))
+
+		_, err = a.Extract("deeper/deep.csv")
+		assert.True(t, errors.Is(err, ErrNotFound), "paths are from the root")
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestIso_ExtractAll(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	a, err := NewIsofile(isoImage(t, dir, "joliet.iso"))
+	require.NoError(t, err)
+	defer a.Close()
+
+	all, err := a.ExtractAll(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, []Member{
+		{Name: "notempty.txt", Data: []byte("this is a file\n")},
+		{Name: "other.txt", Data: []byte("another file\n")},
+	}, all)
+
+	all, err = a.ExtractAll("")
+	require.NoError(t, err)
+	assert.Len(t, all, 5, "no directory")
+}
+
+func TestIso_Walk(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	a, err := NewIsofile(isoImage(t, dir, "rr.iso"))
+	require.NoError(t, err)
+	defer a.Close()
+
+	w, err := a.Walk()
+	require.NoError(t, err)
+
+	n := 0
+	for {
+		e, err := w.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		n++
+
+		if e.Name == "sub/data.xml" {
+			xml, err := ioutil.ReadAll(e)
+			require.NoError(t, err)
+			assert.Equal(t, "<a/>\n", string(xml))
+		}
+	}
+	assert.Equal(t, 7, n)
+}
+
+func TestIso_ExtractTo(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	a, err := NewIsofile(isoImage(t, dir, "rr.iso"))
+	require.NoError(t, err)
+	defer a.Close()
+
+	out := filepath.Join(dir, "out")
+	files, err := a.ExtractTo(out, ExtractOptions{})
+	require.NoError(t, err)
+	assert.Len(t, files, 7)
+
+	csv, err := ioutil.ReadFile(filepath.Join(out, "sub", "deeper", "deep.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "deep\n", string(csv))
+}
+
+func TestIso_Limits(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	fn := isoImage(t, dir, "rr.iso")
+
+	// Checked while reading the tree
+	_, err := New(fn, WithLimits(Limits{MaxEntries: 2}))
+	requireLimit(t, err, "entries")
+
+	a, err := New(fn)
+	require.NoError(t, err)
+	defer a.Close()
+
+	a.(Limiter).SetLimits(Limits{MaxEntries: 2})
+	_, err = a.Extract(".txt")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestIso_FromReader(t *testing.T) {
+	fh, err := os.Open("testdata/plain.iso.gz")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	zfh, err := gzip.NewReader(fh)
+	require.NoError(t, err)
+
+	a, err := NewFromReader(zfh, ArchiveIso)
+	require.NoError(t, err)
+	defer a.Close()
+
+	txt, err := a.Extract("other.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "another file\n", string(txt))
+}
+
+func TestIso_Nested(t *testing.T) {
+	a, err := OpenNested("testdata/joliet.iso.gz")
+	require.NoError(t, err)
+
+	xml, err := a.Extract(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, "<a/>\n", string(xml))
+}
+
+func TestIsoSymlink(t *testing.T) {
+	td := []struct {
+		in   [][]byte
+		link string
+	}{
+		{[][]byte{{0x08, 0, 0, 3, 'e', 't', 'c', 0, 6, 'p', 'a', 's', 's', 'w', 'd'}}, "/etc/passwd"},
+		{[][]byte{{0x04, 0, 0, 12, 'n', 'o', 't', 'e', 'm', 'p', 't', 'y', '.', 't', 'x', 't'}}, "../notempty.txt"},
+		{[][]byte{{0x02, 0, 0, 1, 'a'}}, "./a"},
+		// Component split over two SL entries
+		{[][]byte{{0x01, 3, 'f', 'o', 'o'}, {0, 3, 'b', 'a', 'r'}}, "foobar"},
+	}
+
+	for _, d := range td {
+		var (
+			link string
+			comp bool
+		)
+		for _, b := range d.in {
+			comp = isoSymlink(&link, b, comp)
+		}
+		assert.Equal(t, d.link, link)
+	}
+}
+
+func TestIso_Truncated(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/rr.iso.gz")
+	require.NoError(t, err)
+
+	zfh, err := gzip.NewReader(bytes.NewReader(file))
+	require.NoError(t, err)
+	image, err := ioutil.ReadAll(zfh)
+	require.NoError(t, err)
+
+	_, err = NewIsoFromReaderAt(bytes.NewReader(image[:17*isoSector]), 17*isoSector)
+	assert.Error(t, err)
+}
+
+// isoPatch returns the plain image with the record of name (the ISO
+// identifier, ";1" included for files) changed by patch
+func isoPatch(t *testing.T, name string, patch func(rec []byte)) []byte {
+	file, err := ioutil.ReadFile("testdata/plain.iso.gz")
+	require.NoError(t, err)
+
+	zfh, err := gzip.NewReader(bytes.NewReader(file))
+	require.NoError(t, err)
+	image, err := ioutil.ReadAll(zfh)
+	require.NoError(t, err)
+
+	// The name follows its length in records, not in the path tables
+	id := append([]byte{byte(len(name))}, name...)
+	i := bytes.Index(image, id)
+	require.True(t, i >= 32, name)
+	patch(image[i-32:])
+	return image
+}
+
+func TestIso_MultiExtent(t *testing.T) {
+	setMulti := func(rec []byte) { rec[25] |= isoFlagMulti }
+
+	// Followed by another file
+	image := isoPatch(t, "NOTEMPTY.TXT;1", setMulti)
+	_, err := NewIsoFromReaderAt(bytes.NewReader(image), int64(len(image)))
+	assert.True(t, errors.Is(err, errIsoCorrupt), "%v", err)
+
+	// Last one of its directory
+	image = isoPatch(t, "DEEP.CSV;1", setMulti)
+	_, err = NewIsoFromReaderAt(bytes.NewReader(image), int64(len(image)))
+	assert.True(t, errors.Is(err, errIsoCorrupt), "%v", err)
+}
+
+func TestIso_ExtentSize(t *testing.T) {
+	image := isoPatch(t, "OTHER.TXT;1", func(rec []byte) {
+		binary.LittleEndian.PutUint32(rec[10:], 0x7fffffff)
+		binary.BigEndian.PutUint32(rec[14:], 0x7fffffff)
+	})
+	_, err := NewIsoFromReaderAt(bytes.NewReader(image), int64(len(image)))
+	assert.True(t, errors.Is(err, errIsoCorrupt), "%v", err)
+}
+
+func TestIso_DirectoryLoop(t *testing.T) {
+	// SUB pointing to the root directory
+	image := isoPatch(t, "SUB", func(rec []byte) {
+		copy(rec[2:10], []byte{23, 0, 0, 0, 0, 0, 0, 23})
+	})
+	_, err := NewIsoFromReaderAt(bytes.NewReader(image), int64(len(image)))
+	assert.True(t, errors.Is(err, errIsoCorrupt), "%v", err)
+
+	// SUB over DEEPER, the next sector
+	image = isoPatch(t, "SUB", func(rec []byte) {
+		binary.LittleEndian.PutUint32(rec[10:], 2*isoSector)
+		binary.BigEndian.PutUint32(rec[14:], 2*isoSector)
+	})
+	_, err = NewIsoFromReaderAt(bytes.NewReader(image), int64(len(image)))
+	assert.True(t, errors.Is(err, errIsoCorrupt), "%v", err)
+}
@@ -0,0 +1,215 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// ------------------- Limits
+
+// Limits protects against decompression bombs, a zero value means no limit.
+// For gpg files the limits stop gpgme itself, a custom Decrypter gives the
+// whole plain text and is only checked afterwards.
+type Limits struct {
+	// MaxEntrySize is the maximum uncompressed size of one member
+	MaxEntrySize int64
+	// MaxTotalSize is the maximum uncompressed size of all members read
+	MaxTotalSize int64
+	// MaxRatio is the maximum uncompressed/compressed ratio
+	MaxRatio float64
+	// MaxEntries is the maximum number of members in an archive
+	MaxEntries int
+	// MaxDict is the largest lzma or xz dictionary, allocated before anything
+	// is read.  0 means DefaultMaxDict, not unlimited.
+	MaxDict int
+}
+
+// DefaultMaxDict is enough for xz -9 which uses 64 MB
+const DefaultMaxDict = 64 << 20
+
+// maxDict is MaxDict or its default
+func (l Limits) maxDict() int {
+	if l.MaxDict > 0 {
+		return l.MaxDict
+	}
+	return DefaultMaxDict
+}
+
+// Limiter is for archives accepting limits
+type Limiter interface {
+	SetLimits(l Limits)
+}
+
+// minRatioSize is how much we read before checking the ratio, small files
+// can have huge ratios without being a problem.
+const minRatioSize = 64 << 10
+
+// LimitError is returned when one of the limits has been reached, the
+// archive should be considered hostile.
+type LimitError struct {
+	// Name is the member being read
+	Name string
+	// Limit is which limit was reached
+	Limit string
+}
+
+// Error implements the error interface
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s limit exceeded", e.Name, e.Limit)
+}
+
+// counter counts the bytes read from the compressed stream, or from the
+// whole archive with ReadAt() for 7z where members can be read concurrently.
+type counter struct {
+	r  io.Reader
+	ra io.ReaderAt
+	n  int64
+}
+
+// Read implements io.Reader
+func (c *counter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt
+func (c *counter) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.ra.ReadAt(p, off)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// guard checks the limits over one Extract/Walk call
+type guard struct {
+	lim     Limits
+	in      *counter
+	base    int64 // what in had already read, if it is shared between calls
+	total   int64
+	entries int
+}
+
+// newGuard starts a new set of counters, in is the compressed stream if any
+func newGuard(lim Limits, in *counter) *guard {
+	return &guard{lim: lim, in: in}
+}
+
+// newGuardAt is for archives read with ReadAt() like zip and 7z where in is
+// shared by all the calls, only what is read from now on counts.
+func newGuardAt(lim Limits, in *counter) *guard {
+	g := newGuard(lim, in)
+	if in != nil {
+		g.base = atomic.LoadInt64(&in.n)
+	}
+	return g
+}
+
+// add records n more members
+func (g *guard) add(name string, n int) error {
+	g.entries += n
+	if g.lim.MaxEntries > 0 && g.entries > g.lim.MaxEntries {
+		return &LimitError{Name: name, Limit: "entries"}
+	}
+	return nil
+}
+
+// reader wraps r, csize is the compressed size of the member or -1 if not
+// known in which case we use the compressed stream counter.
+func (g *guard) reader(name string, r io.Reader, csize int64) io.Reader {
+	if g.lim == (Limits{}) {
+		return r
+	}
+	return &limitReader{g: g, name: name, r: r, csize: csize}
+}
+
+// limitReader enforces the limits as data comes in
+type limitReader struct {
+	g     *guard
+	name  string
+	r     io.Reader
+	csize int64
+	n     int64
+}
+
+// Read implements io.Reader
+func (l *limitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	if lerr := l.count(n); lerr != nil {
+		return n, lerr
+	}
+	return n, err
+}
+
+// count adds n bytes and checks the limits
+func (l *limitReader) count(n int) error {
+	l.n += int64(n)
+	l.g.total += int64(n)
+
+	lim := l.g.lim
+	if lim.MaxEntrySize > 0 && l.n > lim.MaxEntrySize {
+		return &LimitError{Name: l.name, Limit: "entry size"}
+	}
+	if lim.MaxTotalSize > 0 && l.g.total > lim.MaxTotalSize {
+		return &LimitError{Name: l.name, Limit: "total size"}
+	}
+	if lim.MaxRatio > 0 && l.n > minRatioSize {
+		csize := l.csize
+		if csize < 0 && l.g.in != nil {
+			csize = atomic.LoadInt64(&l.g.in.n) - l.g.base
+		}
+		if csize > 0 && float64(l.n)/float64(csize) > lim.MaxRatio {
+			return &LimitError{Name: l.name, Limit: "ratio"}
+		}
+	}
+	return nil
+}
+
+// writer is reader() for data pushed to us like the plain text from gpgme,
+// writes fail once a limit is reached and err says which one.
+func (g *guard) writer(name string, w io.Writer, csize int64) *limitWriter {
+	return &limitWriter{l: limitReader{g: g, name: name, csize: csize}, w: w}
+}
+
+// limitWriter enforces the limits before writing
+type limitWriter struct {
+	l   limitReader
+	w   io.Writer
+	err error
+}
+
+// Write implements io.Writer
+func (w *limitWriter) Write(p []byte) (int, error) {
+	if w.err == nil {
+		w.err = w.l.count(len(p))
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.w.Write(p)
+}
+
+// SetLimits changes the limits for this archive
+func (a *Zip) SetLimits(l Limits) {
+	a.lim = l
+}
+
+// SetLimits changes the limits for this archive
+func (a *Tar) SetLimits(l Limits) {
+	a.lim = l
+}
+
+// SetLimits changes the limits for this archive
+func (a *Gzip) SetLimits(l Limits) {
+	a.lim = l
+}
+
+// SetLimits changes the limits for this archive
+func (a *Zstd) SetLimits(l Limits) {
+	a.lim = l
+}
+
+// SetLimits changes the limits for this archive
+func (a *Gpg) SetLimits(l Limits) {
+	a.lim = l
+}
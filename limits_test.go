@@ -0,0 +1,239 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bomb is 2 MB of zeroes, compressing very well
+var bomb = make([]byte, 2<<20)
+
+func requireLimit(t *testing.T, err error, limit string) {
+	require.Error(t, err)
+
+	var le *LimitError
+	require.True(t, errors.As(err, &le), "%v", err)
+	assert.Equal(t, limit, le.Limit)
+}
+
+func TestLimits_Gzip(t *testing.T) {
+	gz := mkGzip(t, "bomb", bomb)
+
+	td := []struct {
+		lim   Limits
+		limit string
+	}{
+		{Limits{}, ""},
+		{Limits{MaxEntrySize: 1 << 20}, "entry size"},
+		{Limits{MaxTotalSize: 1 << 20}, "total size"},
+		{Limits{MaxRatio: 100}, "ratio"},
+		{Limits{MaxRatio: 100000}, ""},
+	}
+
+	for _, d := range td {
+		a, err := NewFromReader(bytes.NewReader(gz), ArchiveGzip)
+		require.NoError(t, err)
+		require.Implements(t, (*Limiter)(nil), a)
+
+		a.(Limiter).SetLimits(d.lim)
+		content, err := a.Extract("")
+		if d.limit == "" {
+			require.NoError(t, err)
+			assert.Len(t, content, len(bomb))
+			continue
+		}
+		requireLimit(t, err, d.limit)
+	}
+}
+
+func TestLimits_Zstd(t *testing.T) {
+	a, err := NewFromReader(bytes.NewReader(mkZstd(t, bomb)), ArchiveZstd)
+	require.NoError(t, err)
+
+	a.(Limiter).SetLimits(Limits{MaxRatio: 10})
+	_, err = a.Extract("")
+	requireLimit(t, err, "ratio")
+}
+
+func TestLimits_Zip(t *testing.T) {
+	file := mkZip(t,
+		member{"a.xml", bomb},
+		member{"b.xml", bomb},
+		member{"c.xml", []byte("<c/>")},
+	)
+
+	a, err := NewZipFromReaderAt(bytes.NewReader(file), int64(len(file)))
+	require.NoError(t, err)
+
+	a.SetLimits(Limits{MaxEntries: 2})
+	_, err = a.Extract(".xml")
+	requireLimit(t, err, "entries")
+
+	a.SetLimits(Limits{MaxTotalSize: 3 << 20})
+	_, err = a.Extract(".xml")
+	require.NoError(t, err)
+	_, err = a.ExtractAll(".xml")
+	requireLimit(t, err, "total size")
+
+	a.SetLimits(Limits{MaxRatio: 50})
+	_, err = a.Extract(".xml")
+	requireLimit(t, err, "ratio")
+
+	a.SetLimits(Limits{MaxEntries: 2})
+	w, err := a.Walk()
+	requireLimit(t, err, "entries")
+	assert.Nil(t, w)
+}
+
+func TestLimits_Tar(t *testing.T) {
+	tgz := mkGzip(t, "", mkTar(t, member{"a", bomb}, member{"b", nil}, member{"c.xml", nil}))
+
+	a, err := NewFromReader(bytes.NewReader(tgz), ArchiveTar|ArchiveGzip)
+	require.NoError(t, err)
+
+	a.(Limiter).SetLimits(Limits{MaxEntries: 2})
+	_, err = a.Extract(".xml")
+	requireLimit(t, err, "entries")
+
+	a, err = NewFromReader(bytes.NewReader(tgz), ArchiveTar|ArchiveGzip)
+	require.NoError(t, err)
+
+	a.(Limiter).SetLimits(Limits{MaxRatio: 100})
+	_, err = a.(MultiExtracter).ExtractAll("")
+	requireLimit(t, err, "ratio")
+
+	a, err = NewFromReader(bytes.NewReader(tgz), ArchiveTar|ArchiveGzip)
+	require.NoError(t, err)
+
+	a.(Limiter).SetLimits(Limits{MaxEntrySize: 1 << 20})
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	_, err = a.(DirExtracter).ExtractTo(dir, ExtractOptions{})
+	requireLimit(t, err, "entry size")
+}
+
+func TestLimits_ZipCompressedSize(t *testing.T) {
+	file := mkZip(t, member{"a.xml", bomb})
+
+	// Claim a huge compressed size in the central directory
+	i := bytes.LastIndex(file, []byte("PK\x01\x02"))
+	require.True(t, i >= 0)
+	binary.LittleEndian.PutUint32(file[i+20:], 0x7fffffff)
+
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "bomb.zip")
+	require.NoError(t, ioutil.WriteFile(fn, file, 0644))
+
+	for _, open := range []func() (*Zip, error){
+		func() (*Zip, error) { return NewZipfile(fn) },
+		func() (*Zip, error) { return NewZipFromReaderAt(bytes.NewReader(file), int64(len(file))) },
+	} {
+		a, err := open()
+		require.NoError(t, err)
+
+		a.SetLimits(Limits{MaxRatio: 50})
+		_, err = a.Extract(".xml")
+		requireLimit(t, err, "ratio")
+
+		_, err = a.ExtractAll("")
+		requireLimit(t, err, "ratio")
+
+		w, err := a.Walk()
+		require.NoError(t, err)
+		e, err := w.Next()
+		require.NoError(t, err)
+		_, err = ioutil.ReadAll(e)
+		requireLimit(t, err, "ratio")
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestLimits_SevenZip(t *testing.T) {
+	file := mkSevenZip(t, "bomb.xml", bomb)
+
+	a, err := NewSevenZipFromReaderAt(bytes.NewReader(file), int64(len(file)))
+	require.NoError(t, err)
+
+	content, err := a.Extract(".xml")
+	require.NoError(t, err)
+	assert.Len(t, content, len(bomb))
+
+	a.SetLimits(Limits{MaxRatio: 50})
+	_, err = a.Extract(".xml")
+	requireLimit(t, err, "ratio")
+
+	_, err = a.ExtractAll("")
+	requireLimit(t, err, "ratio")
+
+	w, err := a.Walk()
+	require.NoError(t, err)
+	e, err := w.Next()
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(e)
+	requireLimit(t, err, "ratio")
+
+	a.SetLimits(Limits{MaxRatio: 100000})
+	_, err = a.Extract(".xml")
+	require.NoError(t, err)
+}
+
+func TestLimits_Gpg(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "bomb.txt.asc")
+	require.NoError(t, ioutil.WriteFile(fn, bomb, 0644))
+
+	lim := Limits{MaxEntrySize: 1 << 20}
+
+	a, err := NewGpgfile(fn, WithDecrypter(NullGPG{}), WithLimits(lim))
+	require.NoError(t, err)
+	require.Implements(t, (*Limiter)(nil), a)
+
+	_, err = a.Extract("")
+	requireLimit(t, err, "entry size")
+
+	w, err := a.Walk()
+	require.NoError(t, err)
+	e, err := w.Next()
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(e)
+	requireLimit(t, err, "entry size")
+
+	a.SetLimits(Limits{})
+	content, err := a.Extract("")
+	require.NoError(t, err)
+	assert.Len(t, content, len(bomb))
+
+	b, err := NewFromReader(bytes.NewReader(bomb), ArchiveGpg, WithDecrypter(NullGPG{}), WithLimits(lim))
+	require.NoError(t, err)
+	_, err = b.Extract("")
+	requireLimit(t, err, "entry size")
+}
+
+func TestLimits_Nested(t *testing.T) {
+	zip := mkZip(t, member{"bomb.xml.gz", mkGzip(t, "", bomb)})
+
+	a, err := NewNestedFromReader(bytes.NewReader(zip))
+	require.NoError(t, err)
+
+	a.Limits = Limits{MaxRatio: 100}
+	_, err = a.Extract(".xml")
+	requireLimit(t, err, "ratio")
+}
+
+func TestLimitError(t *testing.T) {
+	err := &LimitError{Name: "foo.xml", Limit: "ratio"}
+	assert.Equal(t, "foo.xml: ratio limit exceeded", err.Error())
+}
@@ -0,0 +1,197 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ------------------- Listing
+
+// Lister is for archives able to tell what is inside
+type Lister interface {
+	List() ([]EntryInfo, error)
+}
+
+// EntryType is what kind of member we have
+type EntryType int
+
+const (
+	// EntryFile is a regular file
+	EntryFile EntryType = iota
+	// EntryDir is a directory
+	EntryDir
+	// EntrySymlink is a symbolic link
+	EntrySymlink
+	// EntryOther is everything else (devices, fifos, hard links, etc.)
+	EntryOther
+)
+
+// EntryInfo describes one member of an archive.  Sizes are -1 when they are
+// not known without reading everything.  CRC32 is only set for zip and 7z
+// files, Comment for zip ones.
+type EntryInfo struct {
+	Name           string
+	Size           int64
+	CompressedSize int64
+	ModTime        time.Time
+	Mode           os.FileMode
+	Type           EntryType
+	Linkname       string
+	CRC32          uint32
+	Comment        string
+}
+
+// kindOf converts file mode bits into our type
+func kindOf(mode os.FileMode) EntryType {
+	switch {
+	case mode.IsRegular():
+		return EntryFile
+	case mode.IsDir():
+		return EntryDir
+	case mode&os.ModeSymlink != 0:
+		return EntrySymlink
+	}
+	return EntryOther
+}
+
+// zipInfo fills an EntryInfo from the central directory
+func zipInfo(fn *zip.File) EntryInfo {
+	return EntryInfo{
+		Name:           fn.Name,
+		Size:           int64(fn.UncompressedSize64),
+		CompressedSize: int64(fn.CompressedSize64),
+		ModTime:        fn.Modified,
+		Mode:           fn.Mode(),
+		Type:           kindOf(fn.Mode()),
+		CRC32:          fn.CRC32,
+		Comment:        fn.Comment,
+	}
+}
+
+// tarInfo fills an EntryInfo from a tar header
+func tarInfo(hdr *tar.Header) EntryInfo {
+	mode := hdr.FileInfo().Mode()
+
+	info := EntryInfo{
+		Name:           hdr.Name,
+		Size:           hdr.Size,
+		CompressedSize: hdr.Size,
+		ModTime:        hdr.ModTime,
+		Mode:           mode,
+		Type:           kindOf(mode),
+		Linkname:       hdr.Linkname,
+	}
+	if hdr.Typeflag == tar.TypeLink {
+		info.Type = EntryOther
+	}
+	return info
+}
+
+// streamInfo is the synthetic entry of single-stream formats, we only know
+// the compressed size when reading from a file.
+func streamInfo(name string, r io.Reader) EntryInfo {
+	info := EntryInfo{Name: name, Size: -1, CompressedSize: -1, Mode: 0644, Type: EntryFile}
+	if fh, ok := r.(*os.File); ok {
+		if fi, err := fh.Stat(); err == nil {
+			info.CompressedSize = fi.Size()
+			info.ModTime = fi.ModTime()
+		}
+	}
+	return info
+}
+
+// ------------------- Plain
+
+// List returns the file itself
+func (a Plain) List() ([]EntryInfo, error) {
+	if a.Name == "-" {
+		return []EntryInfo{streamInfo(a.Name, a.r)}, nil
+	}
+
+	fi, err := os.Stat(a.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "List")
+	}
+	return []EntryInfo{{
+		Name:           filepath.Base(a.Name),
+		Size:           fi.Size(),
+		CompressedSize: fi.Size(),
+		ModTime:        fi.ModTime(),
+		Mode:           fi.Mode(),
+		Type:           kindOf(fi.Mode()),
+	}}, nil
+}
+
+// ------------------- Zip
+
+// List returns the central directory
+func (a Zip) List() ([]EntryInfo, error) {
+	var list []EntryInfo
+
+	for _, fn := range a.zfh.File {
+		list = append(list, zipInfo(fn))
+	}
+	return list, nil
+}
+
+// ------------------- Tar
+
+// List reads all headers.  Tar is a stream so it can not be used afterwards.
+func (a Tar) List() ([]EntryInfo, error) {
+	var list []EntryInfo
+
+	for {
+		hdr, err := a.tfh.Next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return list, errors.Wrap(err, "read")
+		}
+
+		debug(a.log, "found", Field{"archive", a.fn}, Field{"member", hdr.Name})
+
+		info := tarInfo(hdr)
+		if a.typ != 0 {
+			info.CompressedSize = -1
+		}
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+// ------------------- Gzip
+
+// List returns the one entry we have
+func (a Gzip) List() ([]EntryInfo, error) {
+	return []EntryInfo{streamInfo(a.unc, a.gfh)}, nil
+}
+
+// ------------------- Zstd
+
+// List returns the one entry we have
+func (a Zstd) List() ([]EntryInfo, error) {
+	return []EntryInfo{streamInfo(a.unc, a.gfh)}, nil
+}
+
+// ------------------- Gpg
+
+// List returns the one entry we have
+func (a Gpg) List() ([]EntryInfo, error) {
+	if a.r != nil {
+		return []EntryInfo{streamInfo(a.unc, a.r)}, nil
+	}
+
+	info := streamInfo(a.unc, nil)
+	if fi, err := os.Stat(a.fn); err == nil {
+		info.CompressedSize = fi.Size()
+		info.ModTime = fi.ModTime()
+	}
+	return []EntryInfo{info}, nil
+}
@@ -0,0 +1,141 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"hash/crc32"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestList(t *testing.T) {
+	td := []struct {
+		fn    string
+		names []string
+	}{
+		{"testdata/notempty.txt", []string{"notempty.txt"}},
+		{"testdata/notempty.zip", []string{"notempty.txt"}},
+		{"testdata/notempty.tar", []string{"empty.txt", "notempty.txt"}},
+		{"testdata/notempty.tar.gz", []string{"empty.txt", "notempty.txt"}},
+		{"testdata/notempty.txt.gz", []string{"notempty.txt"}},
+		{"testdata/notempty.txt.zst", []string{"notempty.txt"}},
+		{"testdata/notempty.txt.bz2", []string{"notempty.txt"}},
+		{"testdata/notempty.txt.xz", []string{"notempty.txt"}},
+		{"testdata/notempty.txt.lzma", []string{"notempty.txt"}},
+		{"testdata/notempty.txt.lz4", []string{"notempty.txt"}},
+		{"testdata/notempty.txt.sz", []string{"notempty.txt"}},
+		{"testdata/notempty.txt.br", []string{"notempty.txt"}},
+		{"testdata/notempty.txt.Z", []string{"notempty.txt"}},
+		{"testdata/notempty.txt.zlib", []string{"notempty.txt"}},
+		{"testdata/notempty.txt.deflate", []string{"notempty.txt"}},
+		{"testdata/notempty.a", []string{"short.o", "a-rather-long-member-name.o", "notempty.txt"}},
+		{"testdata/notempty.asc", []string{"notempty"}},
+	}
+
+	for _, d := range td {
+		a, err := New(d.fn)
+		require.NoError(t, err)
+		require.Implements(t, (*Lister)(nil), a)
+
+		list, err := a.(Lister).List()
+		require.NoError(t, err)
+
+		var names []string
+		for _, e := range list {
+			names = append(names, e.Name)
+			assert.Equal(t, EntryFile, e.Type)
+		}
+		assert.Equal(t, d.names, names, d.fn)
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestList_Zip(t *testing.T) {
+	var buf bytes.Buffer
+
+	w := zip.NewWriter(&buf)
+	_, err := w.Create("dir/")
+	require.NoError(t, err)
+	fh, err := w.CreateHeader(&zip.FileHeader{Name: "dir/a.xml", Method: zip.Deflate, Comment: "report"})
+	require.NoError(t, err)
+	_, err = fh.Write(bytes.Repeat([]byte("<a/>"), 100))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	a, err := NewZipFromReader(&buf)
+	require.NoError(t, err)
+
+	list, err := a.List()
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+
+	assert.Equal(t, "dir/", list[0].Name)
+	assert.Equal(t, EntryDir, list[0].Type)
+
+	e := list[1]
+	assert.Equal(t, "dir/a.xml", e.Name)
+	assert.Equal(t, EntryFile, e.Type)
+	assert.EqualValues(t, 400, e.Size)
+	assert.True(t, e.CompressedSize < e.Size)
+	assert.Equal(t, crc32.ChecksumIEEE(bytes.Repeat([]byte("<a/>"), 100)), e.CRC32)
+	assert.Equal(t, "report", e.Comment)
+}
+
+func TestList_Tar(t *testing.T) {
+	a, err := New("testdata/notempty.tar")
+	require.NoError(t, err)
+	defer a.Close()
+
+	list, err := a.(Lister).List()
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+
+	e := list[1]
+	assert.EqualValues(t, 15, e.Size)
+	assert.EqualValues(t, 15, e.CompressedSize)
+	assert.Equal(t, os.FileMode(0644), e.Mode)
+	assert.Equal(t, 2018, e.ModTime.Year())
+}
+
+func TestList_TarCompressed(t *testing.T) {
+	a, err := New("testdata/notempty.tar.zst")
+	require.NoError(t, err)
+	defer a.Close()
+
+	list, err := a.(Lister).List()
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.EqualValues(t, 15, list[1].Size)
+	assert.EqualValues(t, -1, list[1].CompressedSize)
+}
+
+func TestList_Gzip(t *testing.T) {
+	a, err := New("testdata/notempty.txt.gz")
+	require.NoError(t, err)
+	defer a.Close()
+
+	list, err := a.(Lister).List()
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.EqualValues(t, -1, list[0].Size)
+	assert.EqualValues(t, 46, list[0].CompressedSize)
+}
+
+func TestList_FromReader(t *testing.T) {
+	a, err := NewFromReader(bytes.NewBufferString("foo"), ArchiveZstd)
+	require.NoError(t, err)
+
+	list, err := a.(Lister).List()
+	require.NoError(t, err)
+	assert.Equal(t, []EntryInfo{{Name: "-", Size: -1, CompressedSize: -1, Mode: 0644}}, list)
+}
+
+func TestKindOf(t *testing.T) {
+	assert.Equal(t, EntryFile, kindOf(0644))
+	assert.Equal(t, EntryDir, kindOf(os.ModeDir|0755))
+	assert.Equal(t, EntrySymlink, kindOf(os.ModeSymlink|0777))
+	assert.Equal(t, EntryOther, kindOf(os.ModeNamedPipe))
+}
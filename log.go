@@ -0,0 +1,147 @@
+package archive
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// ------------------- Logging
+
+// Level is the importance of a message
+type Level int32
+
+const (
+	// LevelDebug is for the details, what SetDebug() shows
+	LevelDebug Level = iota
+	// LevelInfo is what SetVerbose() shows
+	LevelInfo
+	// LevelNone silences everything
+	LevelNone
+)
+
+// String implements fmt.Stringer
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelNone:
+		return "none"
+	}
+	return fmt.Sprintf("level(%d)", int32(l))
+}
+
+// Field is some context attached to a message like the archive, member or
+// number of bytes.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger receives messages from the archives, it must be safe for concurrent
+// use as several archives can share it.
+type Logger interface {
+	Log(level Level, msg string, fields ...Field)
+}
+
+// Loggable is for archives accepting their own logger
+type Loggable interface {
+	SetLogger(l Logger)
+}
+
+// StdLogger is a Logger over the standard log package, fields are displayed
+// as key=value after the message.
+type StdLogger struct {
+	l     *log.Logger
+	level int32
+}
+
+// NewStdLogger displays messages at level or above on l, the standard logger
+// being used if l is nil.
+func NewStdLogger(l *log.Logger, level Level) *StdLogger {
+	return &StdLogger{l: l, level: int32(level)}
+}
+
+// SetLevel changes the level, it can be called at any time
+func (s *StdLogger) SetLevel(level Level) {
+	atomic.StoreInt32(&s.level, int32(level))
+}
+
+// Level returns the current level
+func (s *StdLogger) Level() Level {
+	return Level(atomic.LoadInt32(&s.level))
+}
+
+// Log implements Logger
+func (s *StdLogger) Log(level Level, msg string, fields ...Field) {
+	if level < s.Level() {
+		return
+	}
+
+	var b strings.Builder
+
+	b.WriteString(msg)
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+	}
+	if s.l == nil {
+		log.Print(b.String())
+		return
+	}
+	s.l.Print(b.String())
+}
+
+// defaultLogger is used by archives without their own logger, this is the
+// one changed by SetVerbose(), SetDebug() and Reset().
+var defaultLogger = NewStdLogger(nil, LevelNone)
+
+// DefaultLogger returns the logger used when none has been set
+func DefaultLogger() *StdLogger {
+	return defaultLogger
+}
+
+// logTo sends the message to l or the default logger if nil
+func logTo(l Logger, level Level, msg string, fields ...Field) {
+	if l == nil {
+		l = defaultLogger
+	}
+	l.Log(level, msg, fields...)
+}
+
+// SetLogger changes the logger for this archive
+func (a *Plain) SetLogger(l Logger) {
+	a.log = l
+}
+
+// SetLogger changes the logger for this archive
+func (a *Zip) SetLogger(l Logger) {
+	a.log = l
+}
+
+// SetLogger changes the logger for this archive
+func (a *Tar) SetLogger(l Logger) {
+	a.log = l
+}
+
+// SetLogger changes the logger for this archive
+func (a *Gzip) SetLogger(l Logger) {
+	a.log = l
+}
+
+// SetLogger changes the logger for this archive
+func (a *Zstd) SetLogger(l Logger) {
+	a.log = l
+}
+
+// SetLogger changes the logger for this archive
+func (a *Gpg) SetLogger(l Logger) {
+	a.log = l
+}
+
+// SetLogger changes the logger for every layer
+func (a *Nested) SetLogger(l Logger) {
+	a.log = l
+}
@@ -0,0 +1,75 @@
+package archive
+
+import (
+	"bytes"
+	"log"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// record is a Logger keeping everything
+type record struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (r *record) Log(level Level, msg string, fields ...Field) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, level.String()+" "+msg)
+}
+
+func TestLevel_String(t *testing.T) {
+	assert.Equal(t, "debug", LevelDebug.String())
+	assert.Equal(t, "info", LevelInfo.String())
+	assert.Equal(t, "none", LevelNone.String())
+	assert.Equal(t, "level(42)", Level(42).String())
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+
+	l := NewStdLogger(log.New(&buf, "", 0), LevelInfo)
+	l.Log(LevelDebug, "hidden")
+	l.Log(LevelInfo, "read", Field{"archive", "foo.tar"}, Field{"member", "a.xml"}, Field{"bytes", 12})
+	assert.Equal(t, "read archive=foo.tar member=a.xml bytes=12\n", buf.String())
+
+	buf.Reset()
+	l.SetLevel(LevelNone)
+	l.Log(LevelInfo, "hidden")
+	assert.Empty(t, buf.String())
+}
+
+func TestDefaultLogger(t *testing.T) {
+	assert.Equal(t, defaultLogger, DefaultLogger())
+}
+
+func TestSetLogger(t *testing.T) {
+	var r record
+
+	a, err := New("testdata/notempty.tar")
+	require.NoError(t, err)
+	defer a.Close()
+	require.Implements(t, (*Loggable)(nil), a)
+
+	a.(Loggable).SetLogger(&r)
+	_, err = a.Extract(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"debug found", "debug read"}, r.msgs)
+}
+
+func TestSetLogger_Zip(t *testing.T) {
+	var r record
+
+	a, err := New("testdata/notempty.zip")
+	require.NoError(t, err)
+	defer a.Close()
+
+	a.(Loggable).SetLogger(&r)
+	_, err = a.Extract(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"info exploring", "info looking at"}, r.msgs)
+}
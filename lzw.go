@@ -0,0 +1,204 @@
+package archive
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ------------------- Unix compress
+
+// compress(1) is LZW but not the variant in compress/lzw: codes grow from 9
+// bits up to the maximum given in the header, code 256 clears the table in
+// "block mode" and the codes are written in groups of 8, the rest of the
+// group being skipped every time the code size changes.  This follows what
+// gzip does in unlzw.c.
+
+const (
+	lzwInitBits  = 9
+	lzwMaxBits   = 16
+	lzwClear     = 256
+	lzwFirst     = 257
+	lzwBlockMode = 0x80
+	lzwBitsMask  = 0x1f
+)
+
+var errLzwCorrupt = errors.New("corrupt input")
+
+// lzwReader decompresses a .Z stream
+type lzwReader struct {
+	r       *bufio.Reader
+	maxbits uint
+	block   bool
+
+	// current group of codes
+	group  []byte
+	bitpos uint
+	bitlen uint
+
+	nbits   uint
+	maxcode int
+	maxmax  int
+	free    int
+	oldcode int
+	finchar byte
+
+	prefix []uint16
+	suffix []byte
+	stack  []byte
+
+	out []byte
+	err error
+}
+
+// compressReader checks the header and returns the decompressor
+func compressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	hdr := make([]byte, 3)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, errors.Wrap(err, "header")
+	}
+	if hdr[0] != magicCompress[0] || hdr[1] != magicCompress[1] {
+		return nil, errors.New("not in compress format")
+	}
+	maxbits := uint(hdr[2] & lzwBitsMask)
+	if maxbits < lzwInitBits || maxbits > lzwMaxBits {
+		return nil, errors.Errorf("compressed with %d bits, can only handle %d to %d", maxbits, lzwInitBits, lzwMaxBits)
+	}
+
+	z := &lzwReader{
+		r:       br,
+		maxbits: maxbits,
+		block:   hdr[2]&lzwBlockMode != 0,
+		group:   make([]byte, lzwMaxBits+2),
+		maxmax:  1 << maxbits,
+		oldcode: -1,
+		prefix:  make([]uint16, 1<<maxbits),
+		suffix:  make([]byte, 1<<maxbits),
+		stack:   make([]byte, 0, 1<<maxbits),
+	}
+	for i := 0; i < 256; i++ {
+		z.suffix[i] = byte(i)
+	}
+	z.setBits(lzwInitBits)
+	z.free = 256
+	if z.block {
+		z.free = lzwFirst
+	}
+	return z, nil
+}
+
+// setBits changes the code size, starting a new group
+func (z *lzwReader) setBits(n uint) {
+	z.nbits = n
+	z.maxcode = 1<<n - 1
+	z.bitpos = z.bitlen
+}
+
+// code returns the next code, io.EOF at the end of the data
+func (z *lzwReader) code() (int, error) {
+	if z.bitpos+z.nbits > z.bitlen {
+		n, err := io.ReadFull(z.r, z.group[:z.nbits])
+		if n == 0 {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		z.bitpos, z.bitlen = 0, uint(n)*8
+		if z.nbits > z.bitlen {
+			// Trailing bits, not a whole code
+			return 0, io.EOF
+		}
+	}
+
+	// A code spans at most 3 bytes, the group has room for that
+	p := z.bitpos >> 3
+	v := uint32(z.group[p]) | uint32(z.group[p+1])<<8 | uint32(z.group[p+2])<<16
+	v >>= z.bitpos & 7
+	z.bitpos += z.nbits
+	return int(v & (1<<z.nbits - 1)), nil
+}
+
+// decode adds the string for the next code to z.out
+func (z *lzwReader) decode() error {
+	if z.free > z.maxcode {
+		z.setBits(z.nbits + 1)
+		// Like compress, only checked when growing so -b9 ends with 10 bits
+		if z.nbits == z.maxbits {
+			z.maxcode = z.maxmax
+		}
+	}
+
+	code, err := z.code()
+	if err != nil {
+		return err
+	}
+
+	if z.oldcode == -1 {
+		if code >= 256 {
+			return errLzwCorrupt
+		}
+		z.oldcode, z.finchar = code, byte(code)
+		z.out = append(z.out, z.finchar)
+		return nil
+	}
+
+	if code == lzwClear && z.block {
+		// The first code after this one makes an entry at 256, never used
+		z.free = lzwFirst - 1
+		z.setBits(lzwInitBits)
+		return nil
+	}
+
+	incode := code
+	z.stack = z.stack[:0]
+	if code >= z.free {
+		// KwKwK
+		if code > z.free {
+			return errLzwCorrupt
+		}
+		z.stack = append(z.stack, z.finchar)
+		code = z.oldcode
+	}
+	for code >= 256 {
+		z.stack = append(z.stack, z.suffix[code])
+		code = int(z.prefix[code])
+	}
+	z.finchar = z.suffix[code]
+	z.stack = append(z.stack, z.finchar)
+	for i := len(z.stack) - 1; i >= 0; i-- {
+		z.out = append(z.out, z.stack[i])
+	}
+
+	if z.free < z.maxmax {
+		z.prefix[z.free] = uint16(z.oldcode)
+		z.suffix[z.free] = z.finchar
+		z.free++
+	}
+	z.oldcode = incode
+	return nil
+}
+
+// Read implements io.Reader
+func (z *lzwReader) Read(p []byte) (int, error) {
+	for len(z.out) < len(p) && z.err == nil {
+		z.err = z.decode()
+	}
+	n := copy(p, z.out)
+	z.out = z.out[n:]
+	if n == 0 && z.err != nil {
+		return 0, z.err
+	}
+	return n, nil
+}
+
+// Close implements io.Closer
+func (z *lzwReader) Close() error {
+	return nil
+}
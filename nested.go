@@ -0,0 +1,326 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// ------------------- Nested
+
+// DefaultMaxDepth is how many layers we are willing to peel by default
+const DefaultMaxDepth = 8
+
+// Layer is one level of a nested archive
+type Layer struct {
+	Type int
+	Name string
+}
+
+// Nested peels successive layers (gpg -> zip -> gzip -> plain, etc.) in memory
+// until it reaches something matching the requested extension.
+type Nested struct {
+	fn string
+	r  io.Reader
+	// MaxDepth is the maximum number of layers we go through
+	MaxDepth int
+	// Limits applies to every layer
+	Limits Limits
+	gpg    Decrypter
+	layers []Layer
+	log    Logger
+}
+
+// OpenNested prepares fn for unwrapping
+func OpenNested(fn string) (*Nested, error) {
+	fh, err := os.Open(fn)
+	if err != nil {
+		return nil, errors.Wrap(err, "OpenNested")
+	}
+	return &Nested{fn: fn, r: fh, MaxDepth: DefaultMaxDepth, gpg: Gpgme{}}, nil
+}
+
+// NewNestedFromReader does the same over an io.Reader
+func NewNestedFromReader(r io.Reader) (*Nested, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	return &Nested{fn: "-", r: r, MaxDepth: DefaultMaxDepth, gpg: Gpgme{}}, nil
+}
+
+// Unwrap is a shortcut to open fn and extract what matches t, returning
+// the layers we went through.
+func Unwrap(fn, t string) ([]byte, []Layer, error) {
+	a, err := OpenNested(fn)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer a.Close()
+
+	content, err := a.Extract(t)
+	return content, a.Layers(), err
+}
+
+// Extract peels layers until it finds content matching t
+func (a *Nested) Extract(t string) ([]byte, error) {
+	data, err := ioutil.ReadAll(a.r)
+	if err != nil {
+		return []byte{}, errors.Wrap(err, "Nested/read")
+	}
+
+	name := a.fn
+	g := newGuard(a.Limits, nil)
+	a.layers = nil
+	for {
+		if t != "" && strings.HasSuffix(name, t) {
+			return data, nil
+		}
+
+		typ := sniff(data)
+		if typ == ArchivePlain && name != "-" {
+			typ = Ext2Type(filepath.Ext(name))
+		}
+
+		if typ == ArchivePlain {
+			if t == "" || name == "-" {
+				return data, nil
+			}
+			return []byte{}, notFound(a.fn, t)
+		}
+
+		if len(a.layers) >= a.MaxDepth {
+			return []byte{}, &LimitError{Name: name, Limit: "depth"}
+		}
+		a.layers = append(a.layers, Layer{Type: typ, Name: name})
+
+		verbose(a.log, "peeling", Field{"archive", name}, Field{"type", typ})
+		data, name, err = a.peel(g, typ, data, name, t)
+		if err != nil {
+			return []byte{}, errors.Wrapf(err, "layer %d", len(a.layers))
+		}
+	}
+}
+
+// peel removes one layer and returns its content and name
+func (a *Nested) peel(g *guard, typ int, data []byte, name, t string) ([]byte, string, error) {
+	r := bytes.NewReader(data)
+	csize := int64(len(data))
+
+	switch typ {
+	case ArchiveGpg:
+		plain, err := decryptReader(a.gpg, r)
+		if err != nil {
+			return nil, "", err
+		}
+		defer plain.Close()
+
+		name = innerName(name)
+		content, err := ioutil.ReadAll(g.reader(name, plain, csize))
+		return content, name, err
+	case ArchiveGzip:
+		zfh, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "gunzip")
+		}
+		defer zfh.Close()
+
+		if zfh.Name != "" {
+			name = zfh.Name
+		} else {
+			name = innerName(name)
+		}
+		content, err := ioutil.ReadAll(g.reader(name, zfh, csize))
+		return content, name, err
+	case ArchiveZstd:
+		zfh, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, "", errors.Wrap(err, "zstd uncompress")
+		}
+		defer zfh.Close()
+
+		name = innerName(name)
+		content, err := ioutil.ReadAll(g.reader(name, zfh, csize))
+		return content, name, err
+	case ArchiveZip:
+		return a.peelZip(g, r, t)
+	case ArchiveTar:
+		return a.peelTar(g, r, t)
+	}
+	return a.peelFormat(g, typ, r, csize, name, t)
+}
+
+// peelFormat uses the registry for everything else
+func (a *Nested) peelFormat(g *guard, typ int, r io.Reader, csize int64, name, t string) ([]byte, string, error) {
+	f, ok := lookupFormat(typ)
+	if !ok {
+		return nil, "", errors.Wrapf(ErrUnsupported, "type %d", typ)
+	}
+
+	name = innerName(name)
+	if f.Decompress != nil {
+		zfh, err := f.Decompress(r)
+		if err != nil {
+			return nil, "", errors.Wrap(err, f.Name)
+		}
+		defer zfh.Close()
+
+		content, err := ioutil.ReadAll(g.reader(name, zfh, csize))
+		return content, name, err
+	}
+
+	if f.OpenReader == nil {
+		return nil, "", errors.Wrapf(ErrUnsupported, "%s from a stream", f.Name)
+	}
+	in, err := f.OpenReader(r, WithLimits(a.Limits), WithDecrypter(a.gpg), WithLogger(a.log))
+	if err != nil {
+		return nil, "", errors.Wrap(err, f.Name)
+	}
+	defer in.Close()
+
+	// Several members, pick one like for tar
+	if m, ok := in.(interface {
+		MultiExtracter
+		Walkable
+	}); ok {
+		return a.peelWalk(g, m, t)
+	}
+
+	content, err := in.Extract(t)
+	return content, name, err
+}
+
+// peelWalk takes the first member matching t or looking like an archive
+func (a *Nested) peelWalk(g *guard, wa Walkable, t string) ([]byte, string, error) {
+	w, err := wa.Walk()
+	if err != nil {
+		return nil, "", err
+	}
+	for {
+		e, err := w.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		debug(a.log, "found", Field{"member", e.Name})
+
+		if err := g.add(e.Name, 1); err != nil {
+			return nil, "", err
+		}
+		if e.Type != EntryFile {
+			continue
+		}
+		if (t != "" && strings.HasSuffix(e.Name, t)) ||
+			Ext2Type(filepath.Ext(e.Name)) != ArchivePlain {
+			content, err := ioutil.ReadAll(g.reader(e.Name, e, -1))
+			return content, e.Name, err
+		}
+	}
+	return nil, "", notFound("-", t)
+}
+
+// peelZip picks the member matching t or the first one looking like an archive
+func (a *Nested) peelZip(g *guard, r *bytes.Reader, t string) ([]byte, string, error) {
+	zfh, err := zip.NewReader(r, r.Size())
+	if err != nil {
+		return nil, "", errors.Wrap(err, "archive/zip")
+	}
+	if err := g.add("-", len(zfh.File)); err != nil {
+		return nil, "", err
+	}
+
+	var pick *zip.File
+
+	for _, fn := range zfh.File {
+		debug(a.log, "looking at", Field{"member", fn.Name})
+
+		if t != "" && strings.HasSuffix(fn.Name, t) {
+			pick = fn
+			break
+		}
+		if pick == nil && Ext2Type(filepath.Ext(fn.Name)) != ArchivePlain {
+			pick = fn
+		}
+	}
+	if pick == nil && len(zfh.File) == 1 {
+		pick = zfh.File[0]
+	}
+	if pick == nil {
+		return nil, "", notFound("-", t)
+	}
+
+	file, err := pick.Open()
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "open %s", pick.Name)
+	}
+	defer file.Close()
+
+	// The size in the directory can not be more than the whole layer
+	csize := int64(pick.CompressedSize64)
+	if csize > r.Size() {
+		csize = r.Size()
+	}
+	content, err := ioutil.ReadAll(g.reader(pick.Name, file, csize))
+	return content, pick.Name, err
+}
+
+// peelTar does the same for tar, we can not go back so take the first one
+func (a *Nested) peelTar(g *guard, r io.Reader, t string) ([]byte, string, error) {
+	tfh := tar.NewReader(r)
+	for {
+		hdr, err := tfh.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, "", errors.Wrap(err, "read")
+		}
+
+		debug(a.log, "found", Field{"member", hdr.Name})
+
+		if err := g.add(hdr.Name, 1); err != nil {
+			return nil, "", err
+		}
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		if (t != "" && strings.HasSuffix(hdr.Name, t)) ||
+			Ext2Type(filepath.Ext(hdr.Name)) != ArchivePlain {
+			content, err := ioutil.ReadAll(g.reader(hdr.Name, tfh, -1))
+			return content, hdr.Name, err
+		}
+	}
+	return nil, "", notFound("-", t)
+}
+
+// innerName removes the outer extension, keeping "-" as is
+func innerName(name string) string {
+	if name == "-" {
+		return name
+	}
+	return uncName(name)
+}
+
+// Layers returns the chain of layers traversed by the last Extract
+func (a *Nested) Layers() []Layer {
+	return a.layers
+}
+
+// Close closes the file if we opened it
+func (a *Nested) Close() error {
+	if fh, ok := a.r.(io.Closer); ok && a.fn != "-" {
+		return fh.Close()
+	}
+	return nil
+}
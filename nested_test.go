@@ -0,0 +1,217 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Helpers to build archives in memory
+
+type member struct {
+	name string
+	data []byte
+}
+
+func mkZip(t *testing.T, files ...member) []byte {
+	var buf bytes.Buffer
+
+	w := zip.NewWriter(&buf)
+	for _, f := range files {
+		fh, err := w.Create(f.name)
+		require.NoError(t, err)
+		_, err = fh.Write(f.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func mkTar(t *testing.T, files ...member) []byte {
+	var buf bytes.Buffer
+
+	w := tar.NewWriter(&buf)
+	for _, f := range files {
+		hdr := &tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data))}
+		require.NoError(t, w.WriteHeader(hdr))
+		_, err := w.Write(f.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func mkGzip(t *testing.T, name string, data []byte) []byte {
+	var buf bytes.Buffer
+
+	w := gzip.NewWriter(&buf)
+	w.Name = name
+	_, err := w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func mkZstd(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+
+	w, err := zstd.NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = w.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+const xmlReport = "<feedback></feedback>\n"
+
+func TestNested_Extract(t *testing.T) {
+	gz := mkGzip(t, "", []byte(xmlReport))
+	zip := mkZip(t, member{"README", []byte("foo")}, member{"report.xml.gz", gz})
+	zst := mkZstd(t, zip)
+
+	a, err := NewNestedFromReader(bytes.NewReader(zst))
+	require.NoError(t, err)
+	defer a.Close()
+
+	xml, err := a.Extract(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, xmlReport, string(xml))
+	assert.Equal(t, []Layer{
+		{ArchiveZstd, "-"},
+		{ArchiveZip, "-"},
+		{ArchiveGzip, "report.xml.gz"},
+	}, a.Layers())
+}
+
+func TestNested_Extract_Tar(t *testing.T) {
+	gz := mkGzip(t, "report.xml", []byte(xmlReport))
+	tgz := mkGzip(t, "", mkTar(t, member{"empty.txt", nil}, member{"foo.gz", gz}))
+
+	a, err := NewNestedFromReader(bytes.NewReader(tgz))
+	require.NoError(t, err)
+
+	xml, err := a.Extract(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, xmlReport, string(xml))
+	assert.Equal(t, []Layer{
+		{ArchiveGzip, "-"},
+		{ArchiveTar, "-"},
+		{ArchiveGzip, "foo.gz"},
+	}, a.Layers())
+}
+
+func TestNested_Extract_Stop(t *testing.T) {
+	zip := mkZip(t, member{"notempty.txt", []byte("this is a file\n")})
+	gz := mkGzip(t, "notempty.zip", zip)
+
+	a, err := NewNestedFromReader(bytes.NewReader(gz))
+	require.NoError(t, err)
+
+	content, err := a.Extract(".zip")
+	require.NoError(t, err)
+	assert.Equal(t, zip, content)
+	assert.Equal(t, []Layer{{ArchiveGzip, "-"}}, a.Layers())
+}
+
+func TestNested_Extract_NotFound(t *testing.T) {
+	zip := mkZip(t, member{"notempty.txt", []byte("this is a file\n")}, member{"foo.doc", nil})
+
+	a, err := NewNestedFromReader(bytes.NewReader(zip))
+	require.NoError(t, err)
+
+	content, err := a.Extract(".xml")
+	require.Error(t, err)
+	assert.Empty(t, content)
+}
+
+func TestNested_Extract_Depth(t *testing.T) {
+	data := []byte(xmlReport)
+	for i := 0; i < 5; i++ {
+		data = mkGzip(t, "", data)
+	}
+
+	a, err := NewNestedFromReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	a.MaxDepth = 3
+
+	content, err := a.Extract(".xml")
+	require.Error(t, err)
+	assert.Empty(t, content)
+	assert.Len(t, a.Layers(), 3)
+}
+
+func TestNested_Extract_Gpg(t *testing.T) {
+	a, err := OpenNested("testdata/notempty.asc")
+	require.NoError(t, err)
+	defer a.Close()
+
+	a.gpg = NullGPG{}
+
+	txt, err := a.Extract("")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+	assert.Equal(t, []Layer{{ArchiveGpg, "testdata/notempty.asc"}}, a.Layers())
+}
+
+func TestNested_Extract_GpgLimits(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "bomb.txt.asc")
+	require.NoError(t, ioutil.WriteFile(fn, bomb, 0644))
+
+	a, err := OpenNested(fn)
+	require.NoError(t, err)
+	defer a.Close()
+
+	a.gpg = NullGPG{}
+	a.Limits = Limits{MaxEntrySize: 1 << 20}
+
+	_, err = a.Extract("")
+	requireLimit(t, err, "entry size")
+}
+
+func TestNested_Extract_GpgError(t *testing.T) {
+	a, err := OpenNested("testdata/notempty.asc")
+	require.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.Extract("")
+	require.Error(t, err)
+}
+
+func TestNewNestedFromReader_Nil(t *testing.T) {
+	a, err := NewNestedFromReader(nil)
+	require.Error(t, err)
+	assert.Nil(t, a)
+}
+
+func TestOpenNested_None(t *testing.T) {
+	a, err := OpenNested("/nonexistent")
+	require.Error(t, err)
+	assert.Nil(t, a)
+}
+
+func TestUnwrap(t *testing.T) {
+	txt, layers, err := Unwrap("testdata/notempty.zip.asc", ".txt")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+	assert.Equal(t, []Layer{{ArchiveZip, "testdata/notempty.zip.asc"}}, layers)
+}
+
+func TestUnwrap_Bzip2(t *testing.T) {
+	txt, layers, err := Unwrap("testdata/notempty.tar.bz2", "notempty.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+	assert.Equal(t, []Layer{{ArchiveBzip2, "testdata/notempty.tar.bz2"}, {ArchiveTar, "notempty.tar"}}, layers)
+}
@@ -0,0 +1,88 @@
+package archive
+
+// ------------------- Options
+
+// Option changes how New(), NewFromReader() and the other constructors
+// open an archive, or how Create() writes one.
+type Option func(*options)
+
+// options is what every constructor gets
+type options struct {
+	typ      int
+	gpg      Decrypter
+	lim      Limits
+	log      Logger
+	password string
+	level    int
+	mem      int64
+}
+
+// newOptions applies opts over the defaults
+func newOptions(opts []Option) options {
+	o := options{gpg: Gpgme{}, mem: DefaultMemoryLimit}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// The password goes to gpgme unless we have been given another decrypter
+	if g, ok := o.gpg.(Gpgme); ok && o.password != "" {
+		g.Password = o.password
+		o.gpg = g
+	}
+	return o
+}
+
+// WithType forces the archive type instead of guessing it, with
+// NewFromReader() it is used only when the type given is 0.
+func WithType(t int) Option {
+	return func(o *options) {
+		o.typ = t
+	}
+}
+
+// WithDecrypter replaces gpgme for encrypted files
+func WithDecrypter(gpg Decrypter) Option {
+	return func(o *options) {
+		o.gpg = gpg
+	}
+}
+
+// WithLimits sets the limits against decompression bombs, see Limits
+func WithLimits(l Limits) Option {
+	return func(o *options) {
+		o.lim = l
+	}
+}
+
+// WithLogger sets the logger instead of the default one
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.log = l
+	}
+}
+
+// WithPassword is for encrypted archives, formats without encryption ignore
+// it.
+func WithPassword(password string) Option {
+	return func(o *options) {
+		o.password = password
+	}
+}
+
+// WithMemoryLimit sets how much of a stream needing random access (zip, 7z,
+// ISO) or of a member of unknown size given to Create() is kept in memory,
+// above that it goes to a temporary file.  The default is DefaultMemoryLimit.
+func WithMemoryLimit(n int64) Option {
+	return func(o *options) {
+		o.mem = n
+	}
+}
+
+// WithLevel sets the compression level for Create(), from 1 (fastest) to 9
+// (best) like gzip.  0, the same as no WithLevel(), is the default level of
+// each format: 6 for zip, gzip, zlib and deflate, the default speed for zstd
+// and the fast mode for lz4.  xz has no levels and ignores it.
+func WithLevel(level int) Option {
+	return func(o *options) {
+		o.level = level
+	}
+}
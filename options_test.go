@@ -0,0 +1,110 @@
+package archive
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOptions(t *testing.T) {
+	o := newOptions(nil)
+	assert.Equal(t, options{gpg: Gpgme{}, mem: DefaultMemoryLimit}, o)
+
+	o = newOptions([]Option{WithPassword("foo")})
+	assert.Equal(t, Gpgme{Password: "foo"}, o.gpg)
+	assert.Equal(t, "foo", o.password)
+
+	o = newOptions([]Option{WithPassword("foo"), WithDecrypter(NullGPG{})})
+	assert.Equal(t, NullGPG{}, o.gpg)
+
+	lim := Limits{MaxEntries: 1}
+	o = newOptions([]Option{WithType(ArchiveZip), WithLimits(lim)})
+	assert.Equal(t, ArchiveZip, o.typ)
+	assert.Equal(t, lim, o.lim)
+
+	o = newOptions([]Option{WithMemoryLimit(16)})
+	assert.Equal(t, int64(16), o.mem)
+}
+
+func TestNew_WithDecrypter(t *testing.T) {
+	a, err := New("testdata/notempty.asc", WithDecrypter(NullGPG{}))
+	require.NoError(t, err)
+	defer a.Close()
+
+	txt, err := a.Extract("")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+}
+
+func TestNew_WithType(t *testing.T) {
+	a, err := New("testdata/notempty.tar.gz", WithType(ArchiveGzip))
+	require.NoError(t, err)
+	defer a.Close()
+	assert.Equal(t, ArchiveGzip, a.Type())
+
+	_, err = New("testdata/notempty.txt", WithType(ArchiveZip))
+	require.Error(t, err)
+}
+
+func TestNew_WithLimits(t *testing.T) {
+	a, err := New("testdata/notempty.zip", WithLimits(Limits{MaxEntries: 0}))
+	require.NoError(t, err)
+	_, err = a.Extract(".txt")
+	require.NoError(t, err)
+	a.Close()
+
+	a, err = New("testdata/notempty.tar.zst", WithLimits(Limits{MaxEntries: 1}))
+	require.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.Extract(".xml")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestNew_WithLogger(t *testing.T) {
+	var r record
+
+	a, err := New("testdata/notempty.zip", WithLogger(&r))
+	require.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.Extract(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"debug detected", "info exploring", "info looking at"}, r.msgs)
+}
+
+func TestNewFromReader_WithType(t *testing.T) {
+	gz := mkGzip(t, "foo", []byte("foo"))
+
+	a, err := NewFromReader(bytes.NewReader(gz), 0, WithType(ArchiveGzip))
+	require.NoError(t, err)
+	assert.Equal(t, ArchiveGzip, a.Type())
+
+	// t wins
+	a, err = NewFromReader(bytes.NewReader(gz), ArchivePlain, WithType(ArchiveGzip))
+	require.NoError(t, err)
+	assert.Equal(t, ArchivePlain, a.Type())
+}
+
+func TestNewFromReader_WithLimits(t *testing.T) {
+	a, err := NewFromReader(bytes.NewReader(mkGzip(t, "bomb", bomb)), ArchiveGzip,
+		WithLimits(Limits{MaxRatio: 10}))
+	require.NoError(t, err)
+
+	_, err = a.Extract("")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestNewTarfile_WithType(t *testing.T) {
+	a, err := NewTarfile("testdata/notempty.tar.gz", WithType(ArchiveTar))
+	require.NoError(t, err)
+	defer a.Close()
+	assert.Equal(t, ArchiveTar, a.Type())
+
+	// Read as a plain tar, this is garbage
+	_, err = a.Extract(".txt")
+	require.Error(t, err)
+}
@@ -0,0 +1,18 @@
+package archive
+
+// ------------------- Packages
+
+// PackageInfo is the metadata of a software package.  Version includes the
+// epoch if any and the Debian revision or RPM release ("1:2.3-1").
+type PackageInfo struct {
+	Name    string
+	Version string
+	Arch    string
+	Depends []string
+}
+
+// Packager is for archives which are software packages (Debian, RPM), the
+// metadata is read when opening them.
+type Packager interface {
+	Info() PackageInfo
+}
@@ -0,0 +1,263 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nwaples/rardecode"
+	"github.com/pkg/errors"
+)
+
+// ------------------- RAR
+
+var magicRar = []byte("Rar!\x1a\x07")
+
+// Rar is for RAR archives, both the v4 (1.5 to 4.x) and v5 formats.  Like Tar
+// it is read sequentially so only one of Extract, ExtractAll, List or Walk
+// can be used.  Encrypted ones need WithPassword().
+type Rar struct {
+	fn  string
+	rfh *rardecode.Reader
+	fh  io.Closer
+	in  *counter
+	lim Limits
+	log Logger
+}
+
+// NewRarfile opens a RAR file, for multi-volume sets (.part1.rar, .r00, etc.)
+// it has to be the first volume and the others are opened when needed.
+func NewRarfile(fn string, opts ...Option) (*Rar, error) {
+	o := newOptions(opts)
+
+	rfh, err := rardecode.OpenReader(fn, o.password)
+	if err != nil {
+		return &Rar{}, errors.Wrap(err, "rar")
+	}
+	return &Rar{fn: fn, rfh: &rfh.Reader, fh: rfh, lim: o.lim, log: o.log}, nil
+}
+
+// NewRarFromReader reads the archive from r, multi-volume sets are not
+// supported that way.
+func NewRarFromReader(r io.Reader, opts ...Option) (*Rar, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	o := newOptions(opts)
+
+	in := &counter{r: r}
+	rfh, err := rardecode.NewReader(in, o.password)
+	if err != nil {
+		return &Rar{}, errors.Wrap(err, "rar")
+	}
+	return &Rar{fn: "-", rfh: rfh, in: in, lim: o.lim, log: o.log}, nil
+}
+
+// rarError makes a wrong password an ErrDecrypt, rardecode does not export
+// its errors so we have to look at the message.
+func rarError(err error) error {
+	if strings.HasSuffix(err.Error(), "incorrect password") {
+		return &kindError{kind: ErrDecrypt, err: err}
+	}
+	return err
+}
+
+// reader guards the member.  PackedSize comes from the archive so we use what
+// was read from streams instead and for files, opened by rardecode, we make
+// sure it is not more than the volumes opened so far.
+func (a Rar) reader(g *guard, hdr *rardecode.FileHeader) io.Reader {
+	if a.in != nil {
+		return g.reader(hdr.Name, a.rfh, -1)
+	}
+
+	csize := hdr.PackedSize
+	if rc, ok := a.fh.(*rardecode.ReadCloser); ok {
+		var size int64
+		for _, vol := range rc.Volumes() {
+			if fi, err := os.Stat(vol); err == nil {
+				size += fi.Size()
+			}
+		}
+		if csize > size {
+			csize = size
+		}
+	}
+	return g.reader(hdr.Name, a.rfh, csize)
+}
+
+// next reads the next header, with io.EOF at the end
+func (a Rar) next() (*rardecode.FileHeader, error) {
+	hdr, err := a.rfh.Next()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, &ArchiveError{Op: "read", Archive: a.fn, Err: rarError(err)}
+	}
+
+	debug(a.log, "found", Field{"archive", a.fn}, Field{"member", hdr.Name})
+	return hdr, nil
+}
+
+// Extract returns the content of the first file whose name ends with t
+func (a Rar) Extract(t string) ([]byte, error) {
+	g := newGuard(a.lim, a.in)
+	for {
+		hdr, err := a.next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return []byte{}, err
+		}
+
+		if err := g.add(hdr.Name, 1); err != nil {
+			return []byte{}, err
+		}
+
+		if !hdr.IsDir && strings.HasSuffix(hdr.Name, t) {
+			var buf bytes.Buffer
+
+			n, err := io.Copy(&buf, a.reader(g, hdr))
+			if err != nil {
+				return []byte{}, errors.Wrap(rarError(err), "copy")
+			}
+			debug(a.log, "read", Field{"archive", a.fn}, Field{"member", hdr.Name}, Field{"bytes", n})
+			return buf.Bytes(), nil
+		}
+	}
+	return nil, notFound(a.fn, t)
+}
+
+// ExtractAll returns every file matching t in archive order, an empty t
+// matches all of them.
+func (a Rar) ExtractAll(t string) ([]Member, error) {
+	var all []Member
+
+	g := newGuard(a.lim, a.in)
+	for {
+		hdr, err := a.next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return all, err
+		}
+
+		if err := g.add(hdr.Name, 1); err != nil {
+			return all, err
+		}
+
+		if hdr.IsDir || !strings.HasSuffix(hdr.Name, t) {
+			continue
+		}
+
+		var buf bytes.Buffer
+
+		n, err := io.Copy(&buf, a.reader(g, hdr))
+		if err != nil {
+			return all, errors.Wrapf(rarError(err), "copy %s", hdr.Name)
+		}
+		debug(a.log, "read", Field{"archive", a.fn}, Field{"member", hdr.Name}, Field{"bytes", n})
+		all = append(all, Member{Name: hdr.Name, Data: buf.Bytes()})
+	}
+
+	if len(all) == 0 {
+		return all, notFound(a.fn, t)
+	}
+	return all, nil
+}
+
+// Close closes the current volume
+func (a Rar) Close() error {
+	if a.fh != nil {
+		return a.fh.Close()
+	}
+	return nil
+}
+
+// Type returns the archive type obviously.
+func (a Rar) Type() int {
+	return ArchiveRar
+}
+
+// rarInfo fills an EntryInfo from a file header, for files split over
+// several volumes the compressed size is the one of the first part.
+func rarInfo(hdr *rardecode.FileHeader) EntryInfo {
+	mode := hdr.Mode()
+
+	info := EntryInfo{
+		Name:           hdr.Name,
+		Size:           hdr.UnPackedSize,
+		CompressedSize: hdr.PackedSize,
+		ModTime:        hdr.ModificationTime,
+		Mode:           mode,
+		Type:           kindOf(mode),
+	}
+	if hdr.UnKnownSize {
+		info.Size = -1
+	}
+	return info
+}
+
+// List reads all headers.  Like Tar it can not be used afterwards.
+func (a Rar) List() ([]EntryInfo, error) {
+	var list []EntryInfo
+
+	for {
+		hdr, err := a.next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return list, err
+		}
+		list = append(list, rarInfo(hdr))
+	}
+	return list, nil
+}
+
+type rarWalker struct {
+	a Rar
+	g *guard
+}
+
+// Walk returns a walker going through the archive
+func (a Rar) Walk() (Walker, error) {
+	return &rarWalker{a: a, g: newGuard(a.lim, a.in)}, nil
+}
+
+// Next reads the next header
+func (w *rarWalker) Next() (*Entry, error) {
+	hdr, err := w.a.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := w.g.add(hdr.Name, 1); err != nil {
+		return nil, err
+	}
+	return &Entry{EntryInfo: rarInfo(hdr), r: w.a.reader(w.g, hdr)}, nil
+}
+
+// ExtractTo writes every member under dir and returns the list of paths
+// created.  Names with "..", absolute ones and symlinks pointing outside dir
+// are rejected.
+func (a Rar) ExtractTo(dir string, opts ExtractOptions) ([]string, error) {
+	w, err := a.Walk()
+	if err != nil {
+		return nil, err
+	}
+	return extractTo(a.log, w, dir, opts)
+}
+
+// SetLimits changes the limits for this archive
+func (a *Rar) SetLimits(l Limits) {
+	a.lim = l
+}
+
+// SetLogger changes the logger for this archive
+func (a *Rar) SetLogger(l Logger) {
+	a.log = l
+}
@@ -0,0 +1,270 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nwaples/rardecode"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRarfile(t *testing.T) {
+	a, err := New("testdata/notempty.rar")
+	require.NoError(t, err)
+	require.IsType(t, (*Rar)(nil), a)
+	defer a.Close()
+
+	assert.Equal(t, ArchiveRar, a.Type())
+	assert.Implements(t, (*MultiExtracter)(nil), a)
+	assert.Implements(t, (*Lister)(nil), a)
+	assert.Implements(t, (*Walkable)(nil), a)
+	assert.Implements(t, (*DirExtracter)(nil), a)
+	assert.Implements(t, (*Limiter)(nil), a)
+	assert.Implements(t, (*Loggable)(nil), a)
+}
+
+func TestNewRarfile_Bad(t *testing.T) {
+	_, err := NewRarfile("/nonexistent")
+	assert.Error(t, err)
+
+	_, err = NewRarfile("testdata/garbage.zip")
+	assert.Error(t, err)
+}
+
+func TestRar_Extract(t *testing.T) {
+	for _, fn := range []string{"testdata/notempty.rar", "testdata/notempty-v4.rar"} {
+		a, err := NewRarfile(fn)
+		require.NoError(t, err)
+
+		txt, err := a.Extract(".txt")
+		require.NoError(t, err, fn)
+		assert.Equal(t, "this is a file\n", string(txt), fn)
+		a.Close()
+
+		a, err = NewRarfile(fn)
+		require.NoError(t, err)
+
+		xml, err := a.Extract("sub/data.xml")
+		require.NoError(t, err, fn)
+		assert.Equal(t, "<a/>\n", string(xml), fn)
+		a.Close()
+	}
+
+	a, err := NewRarfile("testdata/notempty.rar")
+	require.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.Extract(".json")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestRar_ExtractAll(t *testing.T) {
+	a, err := NewRarfile("testdata/notempty.rar")
+	require.NoError(t, err)
+	defer a.Close()
+
+	all, err := a.ExtractAll(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, []Member{
+		{Name: "notempty.txt", Data: []byte("this is a file\n")},
+		{Name: "other.txt", Data: []byte("another file\n")},
+		{Name: "empty.txt", Data: []byte{}},
+	}, all)
+
+	b, err := NewRarfile("testdata/notempty-v4.rar")
+	require.NoError(t, err)
+	defer b.Close()
+
+	all, err = b.ExtractAll("")
+	require.NoError(t, err)
+	assert.Len(t, all, 4, "no directory")
+}
+
+func TestRar_List(t *testing.T) {
+	a, err := NewRarfile("testdata/notempty.rar")
+	require.NoError(t, err)
+	defer a.Close()
+
+	list, err := a.List()
+	require.NoError(t, err)
+	require.Len(t, list, 5)
+
+	assert.Equal(t, "notempty.txt", list[0].Name)
+	assert.Equal(t, int64(15), list[0].Size)
+	assert.Equal(t, int64(15), list[0].CompressedSize, "stored")
+	assert.Equal(t, EntryFile, list[0].Type)
+
+	assert.Equal(t, "sub", list[3].Name)
+	assert.Equal(t, EntryDir, list[3].Type)
+}
+
+func TestRar_Walk(t *testing.T) {
+	a, err := NewRarfile("testdata/notempty-v4.rar")
+	require.NoError(t, err)
+	defer a.Close()
+
+	w, err := a.Walk()
+	require.NoError(t, err)
+
+	var names []string
+	for {
+		e, err := w.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, e.Name)
+
+		if e.Name == "sub/data.xml" {
+			xml, err := ioutil.ReadAll(e)
+			require.NoError(t, err)
+			assert.Equal(t, "<a/>\n", string(xml))
+		}
+	}
+	assert.Equal(t, []string{"notempty.txt", "other.txt", "empty.txt", "sub", "sub/data.xml"}, names)
+}
+
+func TestRar_ExtractTo(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	a, err := NewRarfile("testdata/notempty.rar")
+	require.NoError(t, err)
+	defer a.Close()
+
+	files, err := a.ExtractTo(dir, ExtractOptions{})
+	require.NoError(t, err)
+	assert.Len(t, files, 5)
+
+	xml, err := ioutil.ReadFile(filepath.Join(dir, "sub", "data.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, "<a/>\n", string(xml))
+}
+
+func TestRar_Limits(t *testing.T) {
+	a, err := New("testdata/notempty.rar", WithLimits(Limits{MaxEntries: 1}))
+	require.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.Extract("data.xml")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+
+	b, err := New("testdata/notempty.rar", WithLimits(Limits{MaxEntrySize: 4}))
+	require.NoError(t, err)
+	defer b.Close()
+
+	_, err = b.Extract(".txt")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestRar_MultiVolume(t *testing.T) {
+	a, err := New("testdata/multi.part1.rar")
+	require.NoError(t, err)
+	require.IsType(t, (*Rar)(nil), a)
+	defer a.Close()
+
+	all, err := a.(MultiExtracter).ExtractAll(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, []Member{
+		{Name: "notempty.txt", Data: []byte("this is a file\n")},
+		{Name: "other.txt", Data: []byte("another file\n")},
+	}, all)
+}
+
+func TestRar_Password(t *testing.T) {
+	a, err := New("testdata/encrypted.rar", WithPassword("secret"))
+	require.NoError(t, err)
+	defer a.Close()
+
+	txt, err := a.Extract(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+}
+
+func TestRar_BadPassword(t *testing.T) {
+	for _, pw := range []string{"", "wrong"} {
+		a, err := New("testdata/encrypted.rar", WithPassword(pw))
+		require.NoError(t, err, "names are not encrypted")
+
+		_, err = a.Extract(".txt")
+		assert.True(t, errors.Is(err, ErrDecrypt), "%q: %v", pw, err)
+		a.Close()
+	}
+}
+
+func TestRar_FromReader(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.rar")
+	require.NoError(t, err)
+
+	typ, r, err := Detect(bytes.NewBuffer(file))
+	require.NoError(t, err)
+	assert.Equal(t, ArchiveRar, typ)
+
+	a, err := NewFromReader(r, typ)
+	require.NoError(t, err)
+	defer a.Close()
+
+	txt, err := a.Extract(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+}
+
+func TestNewRarFromReader_Bad(t *testing.T) {
+	_, err := NewRarFromReader(nil)
+	assert.True(t, errors.Is(err, ErrNilReader))
+
+	_, err = NewRarFromReader(bytes.NewBufferString("foobar\n"))
+	assert.Error(t, err)
+}
+
+func TestRar_Nested(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.rar")
+	require.NoError(t, err)
+
+	zip := mkZip(t, member{"inner.rar", file})
+
+	a, err := NewNestedFromReader(bytes.NewReader(zip))
+	require.NoError(t, err)
+
+	xml, err := a.Extract(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, "<a/>\n", string(xml))
+	assert.Equal(t, []Layer{{ArchiveZip, "-"}, {ArchiveRar, "inner.rar"}}, a.Layers())
+}
+
+func TestRar_PackedSize(t *testing.T) {
+	fi, err := os.Stat("testdata/notempty.rar")
+	require.NoError(t, err)
+
+	hdr := &rardecode.FileHeader{Name: "bomb", PackedSize: 1 << 40}
+	g := newGuard(Limits{MaxRatio: 10}, nil)
+
+	// Not more than the file
+	a, err := NewRarfile("testdata/notempty.rar")
+	require.NoError(t, err)
+	defer a.Close()
+
+	lr, ok := a.reader(g, hdr).(*limitReader)
+	require.True(t, ok)
+	assert.Equal(t, fi.Size(), lr.csize)
+
+	// What is read from streams
+	fh, err := os.Open("testdata/notempty.rar")
+	require.NoError(t, err)
+	defer fh.Close()
+
+	a, err = NewRarFromReader(fh)
+	require.NoError(t, err)
+
+	g = newGuard(Limits{MaxRatio: 10}, a.in)
+	lr, ok = a.reader(g, hdr).(*limitReader)
+	require.True(t, ok)
+	assert.Equal(t, int64(-1), lr.csize)
+	assert.True(t, a.in.n > 0)
+}
@@ -0,0 +1,215 @@
+package archive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/cavaliergopher/rpm"
+	"github.com/pkg/errors"
+)
+
+// ------------------- RPM packages
+
+var magicRpm = []byte{0xed, 0xab, 0xee, 0xdb}
+
+// rpmCompressions maps the payload compressor to our types, very old
+// packages do not say and use gzip.
+var rpmCompressions = map[string]int{
+	"":      ArchiveGzip,
+	"gzip":  ArchiveGzip,
+	"bzip2": ArchiveBzip2,
+	"xz":    ArchiveXz,
+	"lzma":  ArchiveLzma,
+	"zstd":  ArchiveZstd,
+}
+
+// Rpm is an RPM package, Extract() and the others work on the files in the
+// cpio payload like with Cpio and Info() gives the metadata from the header.
+type Rpm struct {
+	*Cpio
+	info PackageInfo
+}
+
+// NewRpmfile opens the package and reads the headers
+func NewRpmfile(fn string, opts ...Option) (*Rpm, error) {
+	o := newOptions(opts)
+
+	fh, err := os.Open(fn)
+	if err != nil {
+		return &Rpm{Cpio: &Cpio{}}, errors.Wrap(err, "NewRpmfile")
+	}
+
+	a, err := newRpm(fn, fh, o)
+	if err != nil {
+		fh.Close()
+		return a, err
+	}
+	a.fh = fh
+	return a, nil
+}
+
+// NewRpmFromReader reads the package from r
+func NewRpmFromReader(r io.Reader, opts ...Option) (*Rpm, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	return newRpm("-", r, newOptions(opts))
+}
+
+// newRpm reads the headers, r is then at the start of the payload
+func newRpm(fn string, r io.Reader, o options) (*Rpm, error) {
+	r, err := rpmCheck(r)
+	if err != nil {
+		return &Rpm{Cpio: &Cpio{}}, err
+	}
+	pkg, err := rpmRead(r)
+	if err != nil {
+		return &Rpm{Cpio: &Cpio{}}, err
+	}
+	info, err := rpmInfo(pkg)
+	if err != nil {
+		return &Rpm{Cpio: &Cpio{}}, err
+	}
+
+	if f := pkg.PayloadFormat(); f != "cpio" && f != "" {
+		return &Rpm{Cpio: &Cpio{}}, errors.Wrapf(ErrUnsupported, "rpm payload %s", f)
+	}
+	c, ok := rpmCompressions[pkg.PayloadCompression()]
+	if !ok {
+		return &Rpm{Cpio: &Cpio{}}, errors.Wrapf(ErrUnsupported, "rpm compression %s", pkg.PayloadCompression())
+	}
+	debug(o.log, "payload", Field{"archive", fn}, Field{"type", c})
+
+	a, err := newCpio(fn, r, c, o)
+	if err != nil {
+		return &Rpm{Cpio: &Cpio{}}, err
+	}
+	return &Rpm{Cpio: a, info: info}, nil
+}
+
+const (
+	rpmLeadLen = 96
+	// Same as the rpm package
+	rpmMaxHeader = 32 << 20
+)
+
+// rpmCheck reads the lead and both headers in memory to check what the rpm
+// package allocates from them, a corrupt count would be enough to run out of
+// memory.  The returned reader gives everything back.
+func rpmCheck(r io.Reader) (io.Reader, error) {
+	var buf bytes.Buffer
+
+	if _, err := io.CopyN(&buf, r, rpmLeadLen); err != nil {
+		return nil, errors.Wrap(err, "rpm lead")
+	}
+	tr := io.TeeReader(r, &buf)
+	for i := 0; i < 2; i++ {
+		hdr := make([]byte, 16)
+		if _, err := io.ReadFull(tr, hdr); err != nil {
+			return nil, errors.Wrap(err, "rpm header")
+		}
+		count := int64(binary.BigEndian.Uint32(hdr[8:12]))
+		size := int64(binary.BigEndian.Uint32(hdr[12:16]))
+		if count*16 > rpmMaxHeader || size > rpmMaxHeader {
+			return nil, errors.Wrapf(ErrCorrupt, "rpm header of %d bytes", size)
+		}
+
+		index := make([]byte, count*16)
+		if _, err := io.ReadFull(tr, index); err != nil {
+			return nil, errors.Wrap(err, "rpm header")
+		}
+		if err := rpmCheckIndex(index, size); err != nil {
+			return nil, err
+		}
+
+		// The signature is padded to 8 bytes
+		if i == 0 {
+			size = (size + 7) &^ 7
+		}
+		if _, err := io.CopyN(&buf, r, size); err != nil {
+			return nil, errors.Wrap(err, "rpm header")
+		}
+	}
+	return io.MultiReader(&buf, r), nil
+}
+
+// rpmCheckIndex makes sure every value is inside the store, without
+// overlapping so that the total is bounded too.
+func rpmCheckIndex(index []byte, size int64) error {
+	var total int64
+
+	for ; len(index) > 0; index = index[16:] {
+		typ := binary.BigEndian.Uint32(index[4:8])
+		off := int64(binary.BigEndian.Uint32(index[8:12]))
+		n := int64(binary.BigEndian.Uint32(index[12:16]))
+
+		// int16, int32 and int64, everything else is at least one byte
+		switch typ {
+		case 3:
+			n *= 2
+		case 4:
+			n *= 4
+		case 5:
+			n *= 8
+		}
+		total += n
+		if off+n > size || total > size {
+			return errors.Wrap(ErrCorrupt, "rpm header index")
+		}
+	}
+	return nil
+}
+
+// rpmRead is rpm.Read, which panics on some corrupt headers
+func rpmRead(r io.Reader) (pkg *rpm.Package, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			pkg, err = nil, errors.Wrapf(ErrCorrupt, "rpm: %v", e)
+		}
+	}()
+
+	pkg, err = rpm.Read(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "rpm")
+	}
+	return pkg, nil
+}
+
+// rpmInfo converts the header, the rpmlib() requirements are for rpm itself
+// so they are not included.  The rpm package panics there too.
+func rpmInfo(pkg *rpm.Package) (info PackageInfo, err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			info, err = PackageInfo{}, errors.Wrapf(ErrCorrupt, "rpm: %v", e)
+		}
+	}()
+
+	info = PackageInfo{
+		Name:    pkg.Name(),
+		Version: pkg.Version() + "-" + pkg.Release(),
+		Arch:    pkg.Architecture(),
+	}
+	if pkg.Epoch() > 0 {
+		info.Version = fmt.Sprintf("%d:%s", pkg.Epoch(), info.Version)
+	}
+	for _, d := range pkg.Requires() {
+		if !strings.HasPrefix(d.Name(), "rpmlib(") {
+			info.Depends = append(info.Depends, fmt.Sprint(d))
+		}
+	}
+	return info, nil
+}
+
+// Type returns the archive type obviously.
+func (a *Rpm) Type() int {
+	return ArchiveRpm
+}
+
+// Info returns the metadata from the header
+func (a *Rpm) Info() PackageInfo {
+	return a.info
+}
@@ -0,0 +1,140 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRpmfile(t *testing.T) {
+	a, err := New("testdata/hello-1.0-1.x86_64.rpm")
+	require.NoError(t, err)
+	require.IsType(t, (*Rpm)(nil), a)
+	defer a.Close()
+
+	assert.Equal(t, ArchiveRpm, a.Type())
+	assert.Implements(t, (*Packager)(nil), a)
+	assert.Implements(t, (*MultiExtracter)(nil), a)
+	assert.Implements(t, (*Lister)(nil), a)
+	assert.Implements(t, (*Walkable)(nil), a)
+	assert.Implements(t, (*DirExtracter)(nil), a)
+	assert.Implements(t, (*Limiter)(nil), a)
+
+	assert.Equal(t, PackageInfo{
+		Name:    "hello",
+		Version: "1.0-1",
+		Arch:    "x86_64",
+		Depends: []string{"/bin/sh", "libc.so.6 >= 2.14"},
+	}, a.(Packager).Info())
+}
+
+func TestNewRpmfile_Bad(t *testing.T) {
+	_, err := NewRpmfile("/nonexistent")
+	assert.Error(t, err)
+
+	_, err = NewRpmfile("testdata/notempty.txt")
+	assert.Error(t, err)
+
+	_, err = NewRpmFromReader(nil)
+	assert.True(t, errors.Is(err, ErrNilReader))
+}
+
+func TestRpm_Extract(t *testing.T) {
+	a, err := NewRpmfile("testdata/hello-1.0-1.x86_64.rpm")
+	require.NoError(t, err)
+	defer a.Close()
+
+	conf, err := a.Extract(".conf")
+	require.NoError(t, err)
+	assert.Equal(t, "greeting = hello\n", string(conf))
+}
+
+func TestRpm_List(t *testing.T) {
+	a, err := NewRpmfile("testdata/hello-1.0-1.x86_64.rpm")
+	require.NoError(t, err)
+	defer a.Close()
+
+	list, err := a.List()
+	require.NoError(t, err)
+
+	var names []string
+	for _, e := range list {
+		names = append(names, e.Name)
+	}
+	assert.Equal(t, []string{
+		"./etc/hello",
+		"./etc/hello/hello.conf",
+		"./usr/share/doc/hello",
+		"./usr/share/doc/hello/README",
+	}, names)
+}
+
+func TestRpm_FromReader(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/hello-1.0-1.x86_64.rpm")
+	require.NoError(t, err)
+
+	typ, r, err := Detect(bytes.NewReader(file))
+	require.NoError(t, err)
+	assert.Equal(t, ArchiveRpm, typ)
+
+	a, err := NewFromReader(r, typ)
+	require.NoError(t, err)
+	defer a.Close()
+
+	all, err := a.(MultiExtracter).ExtractAll("README")
+	require.NoError(t, err)
+	assert.Equal(t, []Member{{Name: "./usr/share/doc/hello/README", Data: []byte("Hello\n")}}, all)
+}
+
+func TestRpm_Limits(t *testing.T) {
+	a, err := New("testdata/hello-1.0-1.x86_64.rpm", WithLimits(Limits{MaxEntrySize: 4}))
+	require.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.Extract(".conf")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestRpm_Corrupt(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/hello-1.0-1.x86_64.rpm")
+	require.NoError(t, err)
+
+	_, err = NewRpmFromReader(bytes.NewReader(file[:200]))
+	assert.Error(t, err)
+
+	// The rpm package panics on some of these
+	bad := make([]byte, len(file))
+	for i := range file {
+		for _, x := range []byte{0x01, 0x80, 0xff} {
+			copy(bad, file)
+			bad[i] ^= x
+
+			a, err := NewFromReader(bytes.NewReader(bad), 0)
+			if err == nil {
+				if p, ok := a.(Packager); ok {
+					p.Info()
+				}
+				a.Close()
+			}
+		}
+	}
+
+	// Too many values for the store
+	bad = append([]byte{}, file...)
+	copy(bad[96+16+12:], []byte{0x40, 0, 0, 0})
+	_, err = NewRpmFromReader(bytes.NewReader(bad))
+	assert.True(t, errors.Is(err, ErrCorrupt))
+}
+
+func TestRpm_CloseOnError(t *testing.T) {
+	for _, fn := range []string{"testdata/notempty.a", "testdata/notempty.txt", "testdata/hello_1.0-1_amd64.deb"} {
+		a, err := New(fn, WithType(ArchiveRpm))
+		require.Error(t, err, fn)
+		assert.NoError(t, a.Close())
+		assert.Equal(t, ArchiveRpm, a.Type())
+	}
+}
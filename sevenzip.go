@@ -0,0 +1,337 @@
+package archive
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/pkg/errors"
+	"go4.org/readerutil"
+)
+
+// ------------------- 7-Zip
+
+var magic7z = []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}
+
+// SevenZip is for 7z archives, with every coder known by
+// github.com/bodgit/sevenzip (LZMA, LZMA2, bzip2, deflate, BCJ, etc.).
+// Encrypted ones need WithPassword().
+type SevenZip struct {
+	fn  string
+	zfh *sevenzip.Reader
+	fh  io.Closer
+	tmp string
+	in  *counter
+	lim Limits
+	log Logger
+}
+
+// NewSevenZipfile opens the 7z file, multi-volume sets are opened from the
+// first volume (.7z.001)
+func NewSevenZipfile(fn string, opts ...Option) (*SevenZip, error) {
+	o := newOptions(opts)
+
+	ra, size, fh, err := sevenZipVolumes(fn)
+	if err != nil {
+		return &SevenZip{}, errors.Wrap(err, "7z")
+	}
+
+	a, err := newSevenZip(fn, ra, size, o)
+	if err != nil {
+		fh.Close()
+		return a, err
+	}
+	a.fh = fh
+	return a, nil
+}
+
+// NewSevenZipFromReaderAt uses r directly, without any buffering
+func NewSevenZipFromReaderAt(r io.ReaderAt, size int64, opts ...Option) (*SevenZip, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	return newSevenZip("-", r, size, newOptions(opts))
+}
+
+// NewSevenZipFromReader reads the whole stream like NewZipFromReader(), 7z
+// needs random access too.
+func NewSevenZipFromReader(r io.Reader, opts ...Option) (*SevenZip, error) {
+	if r == nil {
+		return nil, ErrNilReader
+	}
+	o := newOptions(opts)
+
+	ra, size, tmp, err := spool(r, "archive-*.7z", o.mem, o.log)
+	if err != nil {
+		return &SevenZip{}, errors.Wrap(err, "NewSevenZipFromReader")
+	}
+
+	a, err := newSevenZip("-", ra, size, o)
+	if err != nil {
+		unspool(tmp)
+		return a, err
+	}
+	if tmp != nil {
+		a.fh, a.tmp = tmp, tmp.Name()
+	}
+	return a, nil
+}
+
+// newSevenZip reads the header, what is read from r is counted for
+// Limits.MaxRatio as the compressed size is per folder and not given.
+func newSevenZip(fn string, r io.ReaderAt, size int64, o options) (*SevenZip, error) {
+	in := &counter{ra: r}
+	zfh, err := sevenzip.NewReaderWithPassword(in, size, o.password)
+	if err != nil {
+		return &SevenZip{}, errors.Wrap(sevenZipError(err), "7z")
+	}
+	return &SevenZip{fn: fn, zfh: zfh, in: in, lim: o.lim, log: o.log}, nil
+}
+
+// volumes closes every volume of a set
+type volumes []*os.File
+
+// Close implements io.Closer
+func (v volumes) Close() error {
+	var err error
+	for _, fh := range v {
+		if cerr := fh.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// sevenZipVolumes opens fn and the next ones if it is the first volume of a
+// set (.7z.001, .7z.002, etc.) like sevenzip.OpenReader() does.
+func sevenZipVolumes(fn string) (io.ReaderAt, int64, io.Closer, error) {
+	var (
+		vols volumes
+		srs  []readerutil.SizeReaderAt
+	)
+
+	ext := filepath.Ext(fn)
+	for i := 1; ; i++ {
+		name := fn
+		if i > 1 {
+			name = fmt.Sprintf("%s.%03d", strings.TrimSuffix(fn, ext), i)
+		}
+		fh, err := os.Open(name)
+		if err != nil {
+			if i > 1 && os.IsNotExist(err) {
+				break
+			}
+			vols.Close()
+			return nil, 0, nil, err
+		}
+		vols = append(vols, fh)
+
+		fi, err := fh.Stat()
+		if err != nil {
+			vols.Close()
+			return nil, 0, nil, err
+		}
+		srs = append(srs, io.NewSectionReader(fh, 0, fi.Size()))
+
+		if ext != ".001" {
+			return fh, fi.Size(), fh, nil
+		}
+	}
+
+	mr := readerutil.NewMultiReaderAt(srs...)
+	return mr, mr.Size(), vols, nil
+}
+
+// sevenZipError makes a missing or wrong password an ErrDecrypt
+func sevenZipError(err error) error {
+	var re *sevenzip.ReadError
+	if errors.As(err, &re) && re.Encrypted {
+		return &kindError{kind: ErrDecrypt, err: err}
+	}
+	return err
+}
+
+// open gives the content of one member, errors have the context
+func (a SevenZip) open(fn *sevenzip.File) (io.ReadCloser, error) {
+	file, err := fn.Open()
+	if err != nil {
+		return nil, &ArchiveError{Op: "open", Archive: a.fn, Member: fn.Name, Err: sevenZipError(err)}
+	}
+	return file, nil
+}
+
+// Extract returns the content of the first file matching t
+func (a SevenZip) Extract(t string) ([]byte, error) {
+	verbose(a.log, "exploring", Field{"archive", a.fn})
+
+	g := newGuardAt(a.lim, a.in)
+	if err := g.add(a.fn, len(a.zfh.File)); err != nil {
+		return []byte{}, err
+	}
+
+	ft := strings.ToLower(t)
+	for _, fn := range a.zfh.File {
+		verbose(a.log, "looking at", Field{"archive", a.fn}, Field{"member", fn.Name})
+
+		if path.Ext(fn.Name) == ft {
+			file, err := a.open(fn)
+			if err != nil {
+				return []byte{}, err
+			}
+			defer file.Close()
+
+			content, err := ioutil.ReadAll(g.reader(fn.Name, file, -1))
+			if err != nil {
+				return []byte{}, errors.Wrapf(sevenZipError(err), "read %s", fn.Name)
+			}
+			return content, nil
+		}
+	}
+
+	return []byte{}, notFound(a.fn, t)
+}
+
+// ExtractAll returns every file matching t in archive order, an empty t
+// matches all of them.
+func (a SevenZip) ExtractAll(t string) ([]Member, error) {
+	verbose(a.log, "exploring", Field{"archive", a.fn})
+
+	var all []Member
+
+	g := newGuardAt(a.lim, a.in)
+	if err := g.add(a.fn, len(a.zfh.File)); err != nil {
+		return all, err
+	}
+
+	ft := strings.ToLower(t)
+	for _, fn := range a.zfh.File {
+		verbose(a.log, "looking at", Field{"archive", a.fn}, Field{"member", fn.Name})
+
+		if fn.FileInfo().IsDir() || (t != "" && path.Ext(fn.Name) != ft) {
+			continue
+		}
+
+		file, err := a.open(fn)
+		if err != nil {
+			return all, err
+		}
+		content, err := ioutil.ReadAll(g.reader(fn.Name, file, -1))
+		file.Close()
+		if err != nil {
+			return all, errors.Wrapf(sevenZipError(err), "read %s", fn.Name)
+		}
+		all = append(all, Member{Name: fn.Name, Data: content})
+	}
+
+	if len(all) == 0 {
+		return all, notFound(a.fn, t)
+	}
+	return all, nil
+}
+
+// Close closes the file(s) and removes the temporary file if any
+func (a SevenZip) Close() error {
+	if a.fh == nil {
+		return nil
+	}
+	err := a.fh.Close()
+	if a.tmp != "" {
+		os.Remove(a.tmp)
+	}
+	return err
+}
+
+// Type returns the archive type obviously.
+func (a SevenZip) Type() int {
+	return ArchiveSevenZip
+}
+
+// sevenZipInfo fills an EntryInfo from the header, the compressed size is per
+// folder of files so we do not have it.
+func sevenZipInfo(fn *sevenzip.File) EntryInfo {
+	return EntryInfo{
+		Name:           fn.Name,
+		Size:           int64(fn.UncompressedSize),
+		CompressedSize: -1,
+		ModTime:        fn.Modified,
+		Mode:           fn.Mode(),
+		Type:           kindOf(fn.Mode()),
+		CRC32:          fn.CRC32,
+	}
+}
+
+// List returns the header
+func (a SevenZip) List() ([]EntryInfo, error) {
+	var list []EntryInfo
+
+	for _, fn := range a.zfh.File {
+		list = append(list, sevenZipInfo(fn))
+	}
+	return list, nil
+}
+
+type sevenZipWalker struct {
+	a     SevenZip
+	files []*sevenzip.File
+	cur   io.ReadCloser
+	g     *guard
+}
+
+// Walk returns a walker over the header
+func (a SevenZip) Walk() (Walker, error) {
+	g := newGuardAt(a.lim, a.in)
+	if err := g.add(a.fn, len(a.zfh.File)); err != nil {
+		return nil, err
+	}
+	return &sevenZipWalker{a: a, files: a.zfh.File, g: g}, nil
+}
+
+// Next opens the next file, closing the previous one
+func (w *sevenZipWalker) Next() (*Entry, error) {
+	if w.cur != nil {
+		w.cur.Close()
+		w.cur = nil
+	}
+	if len(w.files) == 0 {
+		return nil, io.EOF
+	}
+
+	fn := w.files[0]
+	w.files = w.files[1:]
+
+	verbose(w.a.log, "looking at", Field{"archive", w.a.fn}, Field{"member", fn.Name})
+
+	file, err := w.a.open(fn)
+	if err != nil {
+		return nil, err
+	}
+	w.cur = file
+
+	return &Entry{EntryInfo: sevenZipInfo(fn), r: w.g.reader(fn.Name, file, -1)}, nil
+}
+
+// ExtractTo writes every member under dir and returns the list of paths
+// created.  Names with "..", absolute ones and symlinks pointing outside dir
+// are rejected.
+func (a SevenZip) ExtractTo(dir string, opts ExtractOptions) ([]string, error) {
+	w, err := a.Walk()
+	if err != nil {
+		return nil, err
+	}
+	return extractTo(a.log, w, dir, opts)
+}
+
+// SetLimits changes the limits for this archive
+func (a *SevenZip) SetLimits(l Limits) {
+	a.lim = l
+}
+
+// SetLogger changes the logger for this archive
+func (a *SevenZip) SetLogger(l Logger) {
+	a.log = l
+}
@@ -0,0 +1,323 @@
+package archive
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sevenZipNumber is the variable-length encoding of 7z headers
+func sevenZipNumber(v uint64) []byte {
+	if v < 0x80 {
+		return []byte{byte(v)}
+	}
+	n := 1
+	for n < 8 && v >= 1<<(7*uint(n)+7) {
+		n++
+	}
+	b := []byte{byte(0xff << uint(8-n))}
+	if n < 8 {
+		b[0] |= byte(v >> (8 * uint(n)))
+	}
+	for i := 0; i < n; i++ {
+		b = append(b, byte(v>>(8*uint(i))))
+	}
+	return b
+}
+
+// mkSevenZip makes a 7z with one deflated member, enough for the limits
+func mkSevenZip(t *testing.T, name string, data []byte) []byte {
+	var packed bytes.Buffer
+
+	zfh, err := flate.NewWriter(&packed, flate.BestCompression)
+	require.NoError(t, err)
+	_, err = zfh.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, zfh.Close())
+
+	var hdr bytes.Buffer
+
+	// Header, MainStreamsInfo, PackInfo at 0 with one stream
+	hdr.Write([]byte{0x01, 0x04, 0x06, 0x00, 0x01, 0x09})
+	hdr.Write(sevenZipNumber(uint64(packed.Len())))
+	// UnpackInfo, one folder with the deflate coder
+	hdr.Write([]byte{0x00, 0x07, 0x0b, 0x01, 0x00, 0x01, 0x03, 0x04, 0x01, 0x08, 0x0c})
+	hdr.Write(sevenZipNumber(uint64(len(data))))
+	hdr.Write([]byte{0x00, 0x00})
+
+	// FilesInfo with only the name
+	var names []byte
+	for _, c := range utf16.Encode([]rune(name + "\x00")) {
+		names = append(names, byte(c), byte(c>>8))
+	}
+	hdr.Write([]byte{0x05, 0x01, 0x11})
+	hdr.Write(sevenZipNumber(uint64(len(names) + 1)))
+	hdr.WriteByte(0x00)
+	hdr.Write(names)
+	hdr.Write([]byte{0x00, 0x00})
+
+	start := make([]byte, 20)
+	binary.LittleEndian.PutUint64(start[0:], uint64(packed.Len()))
+	binary.LittleEndian.PutUint64(start[8:], uint64(hdr.Len()))
+	binary.LittleEndian.PutUint32(start[16:], crc32.ChecksumIEEE(hdr.Bytes()))
+
+	file := []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c, 0x00, 0x04}
+	file = append(file, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(file[8:], crc32.ChecksumIEEE(start))
+	file = append(file, start...)
+	file = append(file, packed.Bytes()...)
+	return append(file, hdr.Bytes()...)
+}
+
+func TestNewSevenZipfile(t *testing.T) {
+	a, err := New("testdata/notempty.7z")
+	require.NoError(t, err)
+	require.IsType(t, (*SevenZip)(nil), a)
+	defer a.Close()
+
+	assert.Equal(t, ArchiveSevenZip, a.Type())
+	assert.Implements(t, (*MultiExtracter)(nil), a)
+	assert.Implements(t, (*Lister)(nil), a)
+	assert.Implements(t, (*Walkable)(nil), a)
+	assert.Implements(t, (*DirExtracter)(nil), a)
+	assert.Implements(t, (*Limiter)(nil), a)
+	assert.Implements(t, (*Loggable)(nil), a)
+}
+
+func TestNewSevenZipfile_Bad(t *testing.T) {
+	_, err := NewSevenZipfile("/nonexistent")
+	assert.Error(t, err)
+
+	_, err = NewSevenZipfile("testdata/garbage.zip")
+	assert.Error(t, err)
+}
+
+func TestSevenZip_Extract(t *testing.T) {
+	a, err := NewSevenZipfile("testdata/notempty.7z")
+	require.NoError(t, err)
+	defer a.Close()
+
+	txt, err := a.Extract(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+
+	xml, err := a.Extract(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, "<a/>\n", string(xml))
+
+	_, err = a.Extract(".json")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestSevenZip_Volumes(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	file, err := ioutil.ReadFile("testdata/notempty.7z")
+	require.NoError(t, err)
+
+	half := len(file) / 2
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "test.7z.001"), file[:half], 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "test.7z.002"), file[half:], 0644))
+
+	a, err := NewSevenZipfile(filepath.Join(dir, "test.7z.001"))
+	require.NoError(t, err)
+	defer a.Close()
+
+	xml, err := a.Extract(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, "<a/>\n", string(xml))
+}
+
+func TestSevenZip_ExtractAll(t *testing.T) {
+	a, err := NewSevenZipfile("testdata/notempty.7z")
+	require.NoError(t, err)
+	defer a.Close()
+
+	all, err := a.ExtractAll(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, []Member{
+		{Name: "notempty.txt", Data: []byte("this is a file\n")},
+		{Name: "other.txt", Data: []byte("another file\n")},
+		{Name: "empty.txt", Data: []byte{}},
+	}, all)
+
+	all, err = a.ExtractAll("")
+	require.NoError(t, err)
+	assert.Len(t, all, 4, "no directory")
+
+	_, err = a.ExtractAll(".json")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestSevenZip_List(t *testing.T) {
+	a, err := NewSevenZipfile("testdata/notempty.7z")
+	require.NoError(t, err)
+	defer a.Close()
+
+	list, err := a.List()
+	require.NoError(t, err)
+	require.Len(t, list, 5)
+
+	assert.Equal(t, "notempty.txt", list[0].Name)
+	assert.Equal(t, int64(15), list[0].Size)
+	assert.Equal(t, int64(-1), list[0].CompressedSize)
+	assert.Equal(t, EntryFile, list[0].Type)
+	assert.Equal(t, os.FileMode(0644), list[0].Mode)
+	assert.NotZero(t, list[0].CRC32)
+	assert.Equal(t, 2018, list[0].ModTime.Year())
+
+	assert.Equal(t, EntryDir, list[3].Type)
+}
+
+func TestSevenZip_Walk(t *testing.T) {
+	a, err := NewSevenZipfile("testdata/notempty.7z")
+	require.NoError(t, err)
+	defer a.Close()
+
+	w, err := a.Walk()
+	require.NoError(t, err)
+
+	var names []string
+	for {
+		e, err := w.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, e.Name)
+
+		if e.Name == "sub/data.xml" {
+			xml, err := ioutil.ReadAll(e)
+			require.NoError(t, err)
+			assert.Equal(t, "<a/>\n", string(xml))
+		}
+	}
+	assert.Equal(t, []string{"notempty.txt", "other.txt", "empty.txt", "sub/", "sub/data.xml"}, names)
+}
+
+func TestSevenZip_ExtractTo(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	a, err := NewSevenZipfile("testdata/notempty.7z")
+	require.NoError(t, err)
+	defer a.Close()
+
+	files, err := a.ExtractTo(dir, ExtractOptions{})
+	require.NoError(t, err)
+	assert.Len(t, files, 5)
+
+	xml, err := ioutil.ReadFile(filepath.Join(dir, "sub", "data.xml"))
+	require.NoError(t, err)
+	assert.Equal(t, "<a/>\n", string(xml))
+}
+
+func TestSevenZip_Limits(t *testing.T) {
+	a, err := New("testdata/notempty.7z", WithLimits(Limits{MaxEntries: 2}))
+	require.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.Extract(".txt")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+
+	a.(Limiter).SetLimits(Limits{MaxEntrySize: 4})
+	_, err = a.Extract(".txt")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestSevenZip_Password(t *testing.T) {
+	a, err := New("testdata/encrypted.7z", WithPassword("secret"))
+	require.NoError(t, err)
+	defer a.Close()
+
+	txt, err := a.Extract(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+}
+
+func TestSevenZip_BadPassword(t *testing.T) {
+	for _, pw := range []string{"", "wrong"} {
+		a, err := New("testdata/encrypted.7z", WithPassword(pw))
+		require.NoError(t, err, "names are not encrypted")
+
+		_, err = a.Extract(".txt")
+		assert.True(t, errors.Is(err, ErrDecrypt), "%q: %v", pw, err)
+
+		var ae *ArchiveError
+		require.True(t, errors.As(err, &ae))
+		assert.Equal(t, "notempty.txt", ae.Member)
+		a.Close()
+	}
+}
+
+func TestSevenZip_FromReader(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.7z")
+	require.NoError(t, err)
+
+	typ, r, err := Detect(bytes.NewBuffer(file))
+	require.NoError(t, err)
+	assert.Equal(t, ArchiveSevenZip, typ)
+
+	a, err := NewFromReader(r, typ)
+	require.NoError(t, err)
+	defer a.Close()
+
+	txt, err := a.Extract(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+}
+
+func TestNewSevenZipFromReader_Spill(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/encrypted.7z")
+	require.NoError(t, err)
+
+	a, err := NewSevenZipFromReader(bytes.NewBuffer(file), WithPassword("secret"), WithMemoryLimit(16))
+	require.NoError(t, err)
+	require.NotEmpty(t, a.tmp)
+
+	txt, err := a.Extract(".txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+
+	require.NoError(t, a.Close())
+	_, err = os.Stat(a.tmp)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestNewSevenZipFromReader_Bad(t *testing.T) {
+	_, err := NewSevenZipFromReader(nil)
+	assert.True(t, errors.Is(err, ErrNilReader))
+
+	_, err = NewSevenZipFromReader(bytes.NewBufferString("foobar\n"))
+	assert.Error(t, err)
+
+	_, err = NewSevenZipFromReaderAt(nil, 0)
+	assert.True(t, errors.Is(err, ErrNilReader))
+}
+
+func TestSevenZip_Nested(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.7z")
+	require.NoError(t, err)
+
+	zip := mkZip(t, member{"inner.7z", file})
+
+	a, err := NewNestedFromReader(bytes.NewReader(zip))
+	require.NoError(t, err)
+
+	xml, err := a.Extract(".xml")
+	require.NoError(t, err)
+	assert.Equal(t, "<a/>\n", string(xml))
+	assert.Equal(t, []Layer{{ArchiveZip, "-"}, {ArchiveSevenZip, "inner.7z"}}, a.Layers())
+}
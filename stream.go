@@ -0,0 +1,107 @@
+package archive
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ------------------- Single-stream compression
+
+// stream is the common part of compression formats with only one file inside
+// and nothing in the header worth looking at, each of them just adds Type().
+type stream struct {
+	fn   string
+	unc  string
+	name string
+	gfh  io.Reader
+	fh   io.Closer
+	dec  decoder
+	lim  Limits
+	log  Logger
+}
+
+// decoder starts the decompression of r, the limits are for what has to be
+// checked before like the lzma and xz dictionary.
+type decoder func(r io.Reader, lim Limits) (io.ReadCloser, error)
+
+// anyLimits is for decompressors with nothing to check up front
+func anyLimits(dec func(io.Reader) (io.ReadCloser, error)) decoder {
+	return func(r io.Reader, _ Limits) (io.ReadCloser, error) {
+		return dec(r)
+	}
+}
+
+// openStream opens fn, name is the format name for errors
+func openStream(fn, name string, dec decoder, opts []Option) (stream, error) {
+	o := newOptions(opts)
+
+	fh, err := os.Open(fn)
+	if err != nil {
+		return stream{}, errors.Wrapf(err, "open %s", name)
+	}
+	return stream{fn: fn, unc: uncName(fn), name: name, gfh: fh, fh: fh, dec: dec, lim: o.lim, log: o.log}, nil
+}
+
+// readStream is the same over r
+func readStream(r io.Reader, name string, dec decoder, opts []Option) stream {
+	o := newOptions(opts)
+	return stream{fn: "-", unc: "-", name: name, gfh: r, dec: dec, lim: o.lim, log: o.log}
+}
+
+// Extract returns the content of the file
+func (a stream) Extract(t string) ([]byte, error) {
+	verbose(a.log, "uncompressing", Field{"archive", a.fn}, Field{"type", a.name})
+
+	in := &counter{r: a.gfh}
+	zfh, err := a.dec(in, a.lim)
+	if err != nil {
+		return []byte{}, errors.Wrap(err, a.name)
+	}
+	defer zfh.Close()
+
+	g := newGuard(a.lim, in)
+	content, err := ioutil.ReadAll(g.reader(a.unc, zfh, -1))
+	if err != nil {
+		return []byte{}, errors.Wrap(err, a.name)
+	}
+	return content, nil
+}
+
+// Close closes the file if we opened it
+func (a stream) Close() error {
+	if a.fh != nil {
+		return a.fh.Close()
+	}
+	return nil
+}
+
+// Walk returns a walker with the uncompressed stream as only entry
+func (a stream) Walk() (Walker, error) {
+	in := &counter{r: a.gfh}
+	zfh, err := a.dec(in, a.lim)
+	if err != nil {
+		return nil, errors.Wrap(err, a.name)
+	}
+
+	g := newGuard(a.lim, in)
+	e := &Entry{EntryInfo: streamInfo(a.unc, a.gfh), r: g.reader(a.unc, zfh, -1)}
+	return &oneWalker{e: e, c: zfh}, nil
+}
+
+// List returns the one entry we have
+func (a stream) List() ([]EntryInfo, error) {
+	return []EntryInfo{streamInfo(a.unc, a.gfh)}, nil
+}
+
+// SetLimits changes the limits for this archive
+func (a *stream) SetLimits(l Limits) {
+	a.lim = l
+}
+
+// SetLogger changes the logger for this archive
+func (a *stream) SetLogger(l Logger) {
+	a.log = l
+}
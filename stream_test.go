@@ -0,0 +1,364 @@
+package archive
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// streams are the single-stream formats sharing the same code
+var streams = []struct {
+	fn  string
+	typ int
+}{
+	{"testdata/notempty.txt.xz", ArchiveXz},
+	{"testdata/notempty.txt.lzma", ArchiveLzma},
+	{"testdata/notempty.txt.lz4", ArchiveLz4},
+	{"testdata/notempty.txt.sz", ArchiveSnappy},
+	{"testdata/notempty.txt.br", ArchiveBrotli},
+	{"testdata/notempty.txt.Z", ArchiveCompress},
+	{"testdata/notempty.txt.zlib", ArchiveZlib},
+	{"testdata/notempty.txt.deflate", ArchiveDeflate},
+}
+
+func TestStream_New(t *testing.T) {
+	for _, d := range streams {
+		a, err := New(d.fn)
+		require.NoError(t, err, d.fn)
+		assert.Equal(t, d.typ, a.Type(), d.fn)
+		assert.Implements(t, (*Limiter)(nil), a)
+		assert.Implements(t, (*Loggable)(nil), a)
+		assert.Implements(t, (*Walkable)(nil), a)
+
+		txt, err := a.Extract(".txt")
+		assert.NoError(t, err, d.fn)
+		assert.Equal(t, "this is a file\n", string(txt), d.fn)
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestStream_New_Bad(t *testing.T) {
+	_, err := NewXzfile("/nonexistent")
+	assert.Error(t, err)
+	_, err = NewLzmafile("/nonexistent")
+	assert.Error(t, err)
+	_, err = NewLz4file("/nonexistent")
+	assert.Error(t, err)
+	_, err = NewSnappyfile("/nonexistent")
+	assert.Error(t, err)
+	_, err = NewBrotlifile("/nonexistent")
+	assert.Error(t, err)
+	_, err = NewCompressfile("/nonexistent")
+	assert.Error(t, err)
+	_, err = NewZlibfile("/nonexistent")
+	assert.Error(t, err)
+	_, err = NewDeflatefile("/nonexistent")
+	assert.Error(t, err)
+}
+
+func TestStream_FromReader(t *testing.T) {
+	for _, d := range streams {
+		file, err := ioutil.ReadFile(d.fn)
+		require.NoError(t, err)
+
+		a, err := NewFromReader(bytes.NewReader(file), d.typ)
+		require.NoError(t, err, d.fn)
+		assert.Equal(t, d.typ, a.Type(), d.fn)
+
+		txt, err := a.Extract("")
+		assert.NoError(t, err, d.fn)
+		assert.Equal(t, "this is a file\n", string(txt), d.fn)
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestStream_Walk(t *testing.T) {
+	for _, d := range streams {
+		a, err := New(d.fn)
+		require.NoError(t, err)
+
+		w, err := a.(Walkable).Walk()
+		require.NoError(t, err)
+
+		e, err := w.Next()
+		require.NoError(t, err)
+		assert.Equal(t, "notempty.txt", e.Name)
+
+		txt, err := ioutil.ReadAll(e)
+		require.NoError(t, err)
+		assert.Equal(t, "this is a file\n", string(txt))
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestStream_Limits(t *testing.T) {
+	a, err := New("testdata/notempty.txt.xz", WithLimits(Limits{MaxEntrySize: 4}))
+	require.NoError(t, err)
+	defer a.Close()
+
+	_, err = a.Extract("")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestXz_MultiStream(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.txt.xz")
+	require.NoError(t, err)
+
+	// Two streams and some padding
+	two := append(append(append([]byte{}, file...), 0, 0, 0, 0), file...)
+
+	a, err := NewFromReader(bytes.NewReader(two), ArchiveXz)
+	require.NoError(t, err)
+
+	txt, err := a.Extract("")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\nthis is a file\n", string(txt))
+}
+
+func TestXz_Corrupted(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.txt.xz")
+	require.NoError(t, err)
+
+	// Change the data, the CRC64 check has to catch it
+	bad := append([]byte{}, file...)
+	bad[len(bad)-40] ^= 0xff
+
+	a, err := NewFromReader(bytes.NewReader(bad), ArchiveXz)
+	require.NoError(t, err)
+
+	_, err = a.Extract("")
+	assert.Error(t, err)
+}
+
+func TestLzma_Garbage(t *testing.T) {
+	a, err := NewFromReader(bytes.NewBufferString("not lzma at all"), ArchiveLzma)
+	require.NoError(t, err)
+
+	_, err = a.Extract("")
+	assert.Error(t, err)
+}
+
+func TestLzma_HugeDict(t *testing.T) {
+	// 2 GB dictionary and unknown size
+	bomb := append([]byte{0x5d, 0, 0, 0xff, 0x7f}, bytes.Repeat([]byte{0xff}, 11)...)
+
+	typ, r, err := Detect(bytes.NewReader(bomb))
+	require.NoError(t, err)
+	assert.Equal(t, ArchivePlain, typ)
+
+	a, err := NewFromReader(r, 0, WithLimits(Limits{MaxRatio: 10}))
+	require.NoError(t, err)
+	assert.Equal(t, ArchivePlain, a.Type())
+
+	// Even when asked for
+	a, err = NewFromReader(bytes.NewReader(bomb), ArchiveLzma)
+	require.NoError(t, err)
+
+	_, err = a.Extract("")
+	assert.Error(t, err)
+}
+
+func TestXz_HugeDict(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.txt.xz")
+	require.NoError(t, err)
+
+	// LZMA2 dictionary code of the first block, 4 GB
+	bomb := append([]byte{}, file...)
+	require.Equal(t, byte(0x16), bomb[18])
+	bomb[18] = 40
+
+	a, err := NewFromReader(bytes.NewReader(bomb), ArchiveXz)
+	require.NoError(t, err)
+
+	_, err = a.Extract("")
+	assert.True(t, errors.Is(err, ErrLimitExceeded))
+}
+
+func TestLimits_MaxDict(t *testing.T) {
+	// Both use an 8 MB dictionary
+	for _, fn := range []string{"testdata/notempty.txt.xz", "testdata/notempty.txt.lzma"} {
+		a, err := New(fn, WithLimits(Limits{MaxDict: 1 << 20}))
+		require.NoError(t, err)
+
+		_, err = a.Extract("")
+		assert.Error(t, err, fn)
+
+		a, err = New(fn, WithLimits(Limits{MaxDict: 8 << 20}))
+		require.NoError(t, err)
+
+		_, err = a.Extract("")
+		assert.NoError(t, err, fn)
+	}
+	assert.Equal(t, DefaultMaxDict, Limits{}.maxDict())
+}
+
+func TestLz4_Corrupted(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.txt.lz4")
+	require.NoError(t, err)
+
+	// Change the (uncompressed) data, the content checksum has to catch it
+	bad := append([]byte{}, file...)
+	bad[20] ^= 0xff
+
+	a, err := NewFromReader(bytes.NewReader(bad), ArchiveLz4)
+	require.NoError(t, err)
+
+	_, err = a.Extract("")
+	assert.Error(t, err)
+}
+
+func TestSnappy_Corrupted(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.txt.sz")
+	require.NoError(t, err)
+
+	// Change the data, the CRC has to catch it
+	bad := append([]byte{}, file...)
+	bad[len(bad)-2] ^= 0xff
+
+	a, err := NewFromReader(bytes.NewReader(bad), ArchiveSnappy)
+	require.NoError(t, err)
+
+	_, err = a.Extract("")
+	assert.Error(t, err)
+}
+
+func TestBrotli_NoMagic(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.txt.br")
+	require.NoError(t, err)
+
+	typ, _, err := Detect(bytes.NewReader(file))
+	require.NoError(t, err)
+	assert.Equal(t, ArchivePlain, typ)
+
+	// Only the extension tells us
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "notempty.dat")
+	require.NoError(t, ioutil.WriteFile(fn, file, 0644))
+
+	a, err := New(fn)
+	require.NoError(t, err)
+	assert.Equal(t, ArchivePlain, a.Type())
+	a.Close()
+
+	a, err = New(fn, WithType(ArchiveBrotli))
+	require.NoError(t, err)
+	defer a.Close()
+
+	txt, err := a.Extract("")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+}
+
+func TestBrotli_Nested(t *testing.T) {
+	txt, layers, err := Unwrap("testdata/notempty.tar.br", "notempty.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+	assert.Equal(t, []Layer{{ArchiveBrotli, "testdata/notempty.tar.br"}, {ArchiveTar, "notempty.tar"}}, layers)
+}
+
+// lines is what is in testdata/lines*.txt.Z, long enough for the code size to
+// grow and, with 9 bits, for the table to be cleared
+func lines() string {
+	var b strings.Builder
+	for i := 0; i < 3000; i++ {
+		fmt.Fprintf(&b, "%d\n", i)
+	}
+	return b.String()
+}
+
+func TestCompress_Bits(t *testing.T) {
+	for _, fn := range []string{"testdata/lines.txt.Z", "testdata/lines-b9.txt.Z"} {
+		a, err := New(fn)
+		require.NoError(t, err, fn)
+		assert.Equal(t, ArchiveCompress, a.Type())
+
+		txt, err := a.Extract("")
+		require.NoError(t, err, fn)
+		assert.Equal(t, lines(), string(txt), fn)
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestCompress_Bad(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/lines.txt.Z")
+	require.NoError(t, err)
+
+	td := map[string][]byte{
+		"garbage": []byte("not compressed at all"),
+		"short":   file[:2],
+		"bits":    append([]byte{0x1f, 0x9d, 0x98}, file[3:]...),
+		"corrupt": append([]byte{0x1f, 0x9d, 0x90, 0xff, 0xff}, file[5:]...),
+	}
+
+	for n, d := range td {
+		a, err := NewFromReader(bytes.NewReader(d), ArchiveCompress)
+		require.NoError(t, err, n)
+
+		_, err = a.Extract("")
+		assert.Error(t, err, n)
+	}
+}
+
+func TestZlib_ContentEncoding(t *testing.T) {
+	// What we would get from a "Content-Encoding: deflate" reply
+	body, err := ioutil.ReadFile("testdata/notempty.txt.zlib")
+	require.NoError(t, err)
+
+	typ, r, err := Detect(bytes.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, ArchiveZlib, typ)
+
+	a, err := NewFromReader(r, typ)
+	require.NoError(t, err)
+
+	txt, err := a.Extract("")
+	require.NoError(t, err)
+	assert.Equal(t, "this is a file\n", string(txt))
+}
+
+func TestZlib_Corrupted(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.txt.zlib")
+	require.NoError(t, err)
+
+	// Change the checksum
+	bad := append([]byte{}, file...)
+	bad[len(bad)-1] ^= 0xff
+
+	a, err := NewFromReader(bytes.NewReader(bad), ArchiveZlib)
+	require.NoError(t, err)
+
+	_, err = a.Extract("")
+	assert.Error(t, err)
+}
+
+func TestZlib_Text(t *testing.T) {
+	// Valid zlib header but text nonetheless
+	typ, _, err := Detect(bytes.NewBufferString("x^2 + y^2 = z^2\n"))
+	require.NoError(t, err)
+	assert.Equal(t, ArchivePlain, typ)
+}
+
+func TestDeflate_NoMagic(t *testing.T) {
+	file, err := ioutil.ReadFile("testdata/notempty.txt.deflate")
+	require.NoError(t, err)
+
+	typ, _, err := Detect(bytes.NewReader(file))
+	require.NoError(t, err)
+	assert.Equal(t, ArchivePlain, typ)
+}
+
+func TestStream_Close(t *testing.T) {
+	a, err := NewFromReader(os.Stdin, ArchiveXz)
+	require.NoError(t, err)
+	assert.NoError(t, a.Close())
+}
@@ -1,19 +1,23 @@
 package archive
 
 import (
-	"log"
+	"path/filepath"
+	"strings"
 )
 
-// debug displays only if fDebug is set
-func debug(str string, a ...interface{}) {
-	if fDebug {
-		log.Printf(str, a...)
-	}
+// debug sends details to l, or the default logger if nil
+func debug(l Logger, msg string, fields ...Field) {
+	logTo(l, LevelDebug, msg, fields...)
 }
 
-// verbose displays only if fVerbose is set
-func verbose(str string, a ...interface{}) {
-	if fVerbose {
-		log.Printf(str, a...)
-	}
+// verbose sends information to l, or the default logger if nil
+func verbose(l Logger, msg string, fields ...Field) {
+	logTo(l, LevelInfo, msg, fields...)
+}
+
+// uncName strips the last extension from the base name of fn
+func uncName(fn string) string {
+	base := filepath.Base(fn)
+	pc := strings.Split(base, ".")
+	return strings.Join(pc[0:len(pc)-1], ".")
 }
@@ -5,21 +5,21 @@ import (
 )
 
 func TestVerbose_No(t *testing.T) {
-	verbose("no")
+	verbose(nil, "no")
 }
 
 func TestVerbose_Yes(t *testing.T) {
 	SetVerbose()
-	verbose("yes")
-	fVerbose = false
+	verbose(nil, "yes", Field{"archive", "foo.zip"})
+	Reset()
 }
 
 func TestDebug_No(t *testing.T) {
-	debug("no")
+	debug(nil, "no")
 }
 
 func TestDebug_Yes(t *testing.T) {
 	SetDebug()
-	debug("yes")
-	fDebug = false
+	debug(nil, "yes", Field{"bytes", 42})
+	Reset()
 }
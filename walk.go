@@ -0,0 +1,239 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// ------------------- Walker
+
+// Walker goes through the members of an archive one at a time, Next returns
+// io.EOF when there is nothing left.
+type Walker interface {
+	Next() (*Entry, error)
+}
+
+// Walkable is implemented by every backend
+type Walkable interface {
+	Walk() (Walker, error)
+}
+
+// Entry is one member of an archive, the content is available through Read
+// until the next call to Next.
+type Entry struct {
+	EntryInfo
+	r io.Reader
+}
+
+// Read gives access to the content of the entry
+func (e *Entry) Read(p []byte) (int, error) {
+	if e.r == nil {
+		return 0, io.EOF
+	}
+	return e.r.Read(p)
+}
+
+// oneWalker is for single-stream formats, there is only one entry
+type oneWalker struct {
+	e    *Entry
+	c    io.Closer
+	done bool
+}
+
+// Next returns the entry then io.EOF
+func (w *oneWalker) Next() (*Entry, error) {
+	if w.done {
+		if w.c != nil {
+			w.c.Close()
+			w.c = nil
+		}
+		return nil, io.EOF
+	}
+	w.done = true
+	return w.e, nil
+}
+
+// ------------------- Plain
+
+// Walk returns a walker with the file as only entry
+func (a Plain) Walk() (Walker, error) {
+	list, err := a.List()
+	if err != nil {
+		return nil, errors.Wrap(err, "Walk")
+	}
+	return &oneWalker{e: &Entry{EntryInfo: list[0], r: a.r}}, nil
+}
+
+// ------------------- Zip
+
+type zipWalker struct {
+	fn    string
+	files []*zip.File
+	cur   io.ReadCloser
+	g     *guard
+	log   Logger
+}
+
+// Walk returns a walker over the central directory
+func (a Zip) Walk() (Walker, error) {
+	g := newGuardAt(a.lim, a.in)
+	if err := g.add(a.fn, len(a.zfh.File)); err != nil {
+		return nil, err
+	}
+	return &zipWalker{fn: a.fn, files: a.zfh.File, g: g, log: a.log}, nil
+}
+
+// Next opens the next file, closing the previous one
+func (w *zipWalker) Next() (*Entry, error) {
+	if w.cur != nil {
+		w.cur.Close()
+		w.cur = nil
+	}
+	if len(w.files) == 0 {
+		return nil, io.EOF
+	}
+
+	fn := w.files[0]
+	w.files = w.files[1:]
+
+	verbose(w.log, "looking at", Field{"archive", w.fn}, Field{"member", fn.Name})
+
+	file, err := fn.Open()
+	if err != nil {
+		return nil, errors.Wrapf(err, "open %s", fn.Name)
+	}
+	w.cur = file
+
+	r := w.g.reader(fn.Name, file, -1)
+	return &Entry{EntryInfo: zipInfo(fn), r: r}, nil
+}
+
+// ------------------- Tar
+
+type tarWalker struct {
+	fn  string
+	tfh *tar.Reader
+	g   *guard
+	log Logger
+}
+
+// Walk returns a walker going through the stream
+func (a Tar) Walk() (Walker, error) {
+	return &tarWalker{fn: a.fn, tfh: a.tfh, g: newGuard(a.lim, a.in), log: a.log}, nil
+}
+
+// Next reads the next header
+func (w *tarWalker) Next() (*Entry, error) {
+	hdr, err := w.tfh.Next()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "read")
+	}
+
+	debug(w.log, "found", Field{"archive", w.fn}, Field{"member", hdr.Name})
+
+	if err := w.g.add(hdr.Name, 1); err != nil {
+		return nil, err
+	}
+	return &Entry{EntryInfo: tarInfo(hdr), r: w.g.reader(hdr.Name, w.tfh, -1)}, nil
+}
+
+// ------------------- Gzip
+
+// Walk returns a walker with the uncompressed stream as only entry
+func (a Gzip) Walk() (Walker, error) {
+	in := &counter{r: a.gfh}
+	zfh, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, errors.Wrap(err, "gunzip")
+	}
+
+	g := newGuard(a.lim, in)
+	e := &Entry{EntryInfo: streamInfo(a.unc, a.gfh), r: g.reader(a.unc, zfh, -1)}
+	if zfh.Name != "" {
+		e.Name = zfh.Name
+	}
+	if !zfh.ModTime.IsZero() {
+		e.ModTime = zfh.ModTime
+	}
+	return &oneWalker{e: e, c: zfh}, nil
+}
+
+// ------------------- Zstd
+
+// Walk returns a walker with the uncompressed stream as only entry
+func (a Zstd) Walk() (Walker, error) {
+	in := &counter{r: a.gfh}
+	zfh, err := zstd.NewReader(in)
+	if err != nil {
+		return nil, errors.Wrap(err, "zstd uncompress")
+	}
+
+	rc := zfh.IOReadCloser()
+	g := newGuard(a.lim, in)
+	e := &Entry{EntryInfo: streamInfo(a.unc, a.gfh), r: g.reader(a.unc, rc, -1)}
+	return &oneWalker{e: e, c: rc}, nil
+}
+
+// ------------------- Gpg
+
+// gpgCloser closes both the plain text and the file
+type gpgCloser struct {
+	plain io.Closer
+	fh    io.Closer
+}
+
+func (c gpgCloser) Close() error {
+	c.plain.Close()
+	if c.fh != nil {
+		return c.fh.Close()
+	}
+	return nil
+}
+
+// Walk returns a walker with the decrypted stream as only entry
+func (a Gpg) Walk() (Walker, error) {
+	var (
+		r  = a.r
+		fh *os.File
+	)
+
+	list, _ := a.List()
+
+	if r == nil {
+		var err error
+
+		fh, err = os.Open(a.fn)
+		if err != nil {
+			return nil, errors.Wrap(err, "Walk/open")
+		}
+		r = fh
+	}
+
+	verbose(a.log, "decrypting", Field{"archive", a.fn})
+
+	in := &counter{r: r}
+	plain, err := decryptReader(a.gpg, in)
+	if err != nil {
+		if fh != nil {
+			fh.Close()
+		}
+		return nil, err
+	}
+
+	c := gpgCloser{plain: plain}
+	if fh != nil {
+		c.fh = fh
+	}
+	g := newGuard(a.lim, in)
+	e := &Entry{EntryInfo: list[0], r: g.reader(list[0].Name, plain, -1)}
+	return &oneWalker{e: e, c: c}, nil
+}
@@ -0,0 +1,142 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// walkAll collects names and content of every entry
+func walkAll(t *testing.T, a interface{}) ([]string, []string) {
+	require.Implements(t, (*Walkable)(nil), a)
+
+	w, err := a.(Walkable).Walk()
+	require.NoError(t, err)
+
+	var names, data []string
+
+	for {
+		e, err := w.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		content, err := ioutil.ReadAll(e)
+		require.NoError(t, err)
+
+		names = append(names, e.Name)
+		data = append(data, string(content))
+	}
+
+	// Still at the end
+	_, err = w.Next()
+	require.Equal(t, io.EOF, err)
+	return names, data
+}
+
+func TestWalk(t *testing.T) {
+	td := []struct {
+		fn    string
+		names []string
+	}{
+		{"testdata/notempty.txt", []string{"notempty.txt"}},
+		{"testdata/notempty.zip", []string{"notempty.txt"}},
+		{"testdata/notempty.tar", []string{"empty.txt", "notempty.txt"}},
+		{"testdata/notempty.tar.gz", []string{"empty.txt", "notempty.txt"}},
+		{"testdata/notempty.tar.zst", []string{"empty.txt", "notempty.txt"}},
+		{"testdata/notempty.txt.gz", []string{"notempty.txt"}},
+		{"testdata/notempty.txt.zst", []string{"notempty.txt"}},
+	}
+
+	for _, d := range td {
+		a, err := New(d.fn)
+		require.NoError(t, err)
+
+		names, data := walkAll(t, a)
+		assert.Equal(t, d.names, names, d.fn)
+		assert.Equal(t, "this is a file\n", data[len(data)-1], d.fn)
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestWalk_Metadata(t *testing.T) {
+	a, err := New("testdata/notempty.tar")
+	require.NoError(t, err)
+	defer a.Close()
+
+	w, err := a.(Walkable).Walk()
+	require.NoError(t, err)
+
+	_, err = w.Next()
+	require.NoError(t, err)
+
+	e, err := w.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "notempty.txt", e.Name)
+	assert.EqualValues(t, 15, e.Size)
+	assert.Equal(t, os.FileMode(0644), e.Mode)
+	assert.Equal(t, 2018, e.ModTime.Year())
+}
+
+func TestWalk_Zip_Skip(t *testing.T) {
+	file := mkZip(t, member{"a.xml", []byte("<a/>")}, member{"b.xml", []byte("<b/>")})
+
+	a, err := NewZipFromReaderAt(bytes.NewReader(file), int64(len(file)))
+	require.NoError(t, err)
+
+	w, err := a.Walk()
+	require.NoError(t, err)
+
+	// Do not read the first one
+	e, err := w.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "a.xml", e.Name)
+	assert.EqualValues(t, 4, e.Size)
+
+	e, err = w.Next()
+	require.NoError(t, err)
+
+	content, err := ioutil.ReadAll(e)
+	require.NoError(t, err)
+	assert.Equal(t, "<b/>", string(content))
+}
+
+func TestWalk_FromReader(t *testing.T) {
+	a, err := NewFromReader(bytes.NewBufferString("this is a file\n"), ArchivePlain)
+	require.NoError(t, err)
+
+	names, data := walkAll(t, a)
+	assert.Equal(t, []string{"-"}, names)
+	assert.Equal(t, []string{"this is a file\n"}, data)
+}
+
+func TestWalk_Gzip_Bad(t *testing.T) {
+	a, err := NewFromReader(bytes.NewBufferString("foobar"), ArchiveGzip)
+	require.NoError(t, err)
+
+	w, err := a.(Walkable).Walk()
+	require.Error(t, err)
+	assert.Nil(t, w)
+}
+
+func TestWalk_Gpg(t *testing.T) {
+	a := &Gpg{fn: "testdata/notempty.asc", unc: "notempty", gpg: NullGPG{}}
+
+	names, data := walkAll(t, a)
+	assert.Equal(t, []string{"notempty"}, names)
+	assert.Equal(t, []string{"this is a file\n"}, data)
+}
+
+func TestWalk_Gpg_None(t *testing.T) {
+	a := &Gpg{fn: "/nonexistent", unc: "nonexistent", gpg: NullGPG{}}
+
+	w, err := a.Walk()
+	require.Error(t, err)
+	assert.Nil(t, w)
+}
@@ -0,0 +1,395 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"os"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/pkg/errors"
+)
+
+// ------------------- Archive creation
+
+// Archiver is the writing side of the module, see Create().  Members are
+// written in the order they are added and the archive is complete only after
+// Close().
+type Archiver interface {
+	// AddFile copies the file fn as name
+	AddFile(name, fn string) error
+	// AddBytes adds data as name
+	AddBytes(name string, data []byte) error
+	// AddReader copies r as name, size is -1 when not known
+	AddReader(name string, r io.Reader, size int64) error
+	Close() error
+	Type() int
+}
+
+// Create makes a new archive, the type is the one given or the one from the
+// extension like with New() (".zip", ".tar.gz", ".zst", etc.).  WithLevel()
+// sets the compression level.
+func Create(fn string, t int, opts ...Option) (Archiver, error) {
+	o := newOptions(opts)
+
+	if t == 0 {
+		t = o.typ
+	}
+	if t == 0 {
+		t = Ext2Type(FullExt(fn))
+	}
+	// Do not overwrite anything if we can not do it
+	if err := canCreate(t, o.level); err != nil {
+		return nil, errors.Wrap(err, "Create")
+	}
+
+	fh, err := os.Create(fn)
+	if err != nil {
+		return nil, errors.Wrap(err, "Create")
+	}
+
+	a, err := newWriter(fn, fh, fh, t, o)
+	if err != nil {
+		fh.Close()
+		os.Remove(fn)
+		return nil, err
+	}
+	return a, nil
+}
+
+// NewWriter is the same as Create() over w, t can not be guessed here.
+// Closing the archive does not close w.
+func NewWriter(w io.Writer, t int, opts ...Option) (Archiver, error) {
+	if w == nil {
+		return nil, ErrNilWriter
+	}
+	o := newOptions(opts)
+
+	if t == 0 {
+		t = o.typ
+	}
+	if err := canCreate(t, o.level); err != nil {
+		return nil, errors.Wrap(err, "NewWriter")
+	}
+	return newWriter("-", w, nil, t, o)
+}
+
+// canCreate tells whether we know how to write t
+func canCreate(t, level int) error {
+	if level < 0 || level > 9 {
+		return errors.Errorf("compression level %d not between 0 and 9", level)
+	}
+
+	c := t
+	switch {
+	case t == ArchiveZip || t == ArchiveTar:
+		return nil
+	case t&ArchiveTar != 0:
+		c = t &^ ArchiveTar
+	}
+	if compressor(c) == nil {
+		return errors.Wrapf(ErrUnsupported, "creating type %d", t)
+	}
+	return nil
+}
+
+// newWriter sets up the writer for t over w, fh is closed at the end if set
+func newWriter(fn string, w io.Writer, fh io.Closer, t int, o options) (Archiver, error) {
+	if t == ArchiveZip {
+		return newZipWriter(fn, w, fh, o), nil
+	}
+
+	c := t &^ ArchiveTar
+	if t&ArchiveTar != 0 {
+		if c == 0 {
+			return &TarWriter{fn: fn, tw: tar.NewWriter(w), fh: fh, mem: o.mem, log: o.log}, nil
+		}
+		zfh, err := compressor(c)(w, o.level)
+		if err != nil {
+			return nil, errors.Wrap(err, "compress")
+		}
+		return &TarWriter{fn: fn, typ: c, tw: tar.NewWriter(zfh), zfh: zfh, fh: fh, mem: o.mem, log: o.log}, nil
+	}
+
+	zfh, err := compressor(c)(w, o.level)
+	if err != nil {
+		return nil, errors.Wrap(err, "compress")
+	}
+	return &StreamWriter{fn: fn, typ: c, zfh: zfh, fh: fh, log: o.log}, nil
+}
+
+// flateLevel converts our levels for compress/flate and friends, 0 is
+// their default (6)
+func flateLevel(level int) int {
+	if level == 0 {
+		return flate.DefaultCompression
+	}
+	return level
+}
+
+// zstdLevel converts our levels, zstd has only four of them
+func zstdLevel(level int) zstd.EncoderLevel {
+	switch {
+	case level == 0:
+		return zstd.SpeedDefault
+	case level <= 2:
+		return zstd.SpeedFastest
+	case level <= 5:
+		return zstd.SpeedDefault
+	case level <= 7:
+		return zstd.SpeedBetterCompression
+	}
+	return zstd.SpeedBestCompression
+}
+
+// lz4Levels are ours in lz4 terms
+var lz4Levels = []lz4.CompressionLevel{
+	lz4.Fast, lz4.Level1, lz4.Level2, lz4.Level3, lz4.Level4,
+	lz4.Level5, lz4.Level6, lz4.Level7, lz4.Level8, lz4.Level9,
+}
+
+// addFile opens fn and gives it to add with its mode and time
+func addFile(add func(EntryInfo, io.Reader) error, name, fn string) error {
+	fh, err := os.Open(fn)
+	if err != nil {
+		return errors.Wrap(err, "AddFile")
+	}
+	defer fh.Close()
+
+	fi, err := fh.Stat()
+	if err != nil {
+		return errors.Wrap(err, "AddFile")
+	}
+	if !fi.Mode().IsRegular() {
+		return errors.Wrapf(ErrUnsupported, "%s is not a regular file", fn)
+	}
+	return add(EntryInfo{Name: name, Size: fi.Size(), ModTime: fi.ModTime(), Mode: fi.Mode()}, fh)
+}
+
+// newEntry is for members not coming from a file
+func newEntry(name string, size int64) EntryInfo {
+	return EntryInfo{Name: name, Size: size, ModTime: time.Now(), Mode: 0644}
+}
+
+// addError gives the context of errors while writing
+func addError(fn, name string, err error) error {
+	return &ArchiveError{Op: "add", Archive: fn, Member: name, Err: err}
+}
+
+// ------------------- Zip
+
+// ZipWriter creates zip files, members are deflated
+type ZipWriter struct {
+	fn  string
+	zw  *zip.Writer
+	fh  io.Closer
+	log Logger
+}
+
+// newZipWriter uses our level for deflate
+func newZipWriter(fn string, w io.Writer, fh io.Closer, o options) *ZipWriter {
+	zw := zip.NewWriter(w)
+	zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, flateLevel(o.level))
+	})
+	return &ZipWriter{fn: fn, zw: zw, fh: fh, log: o.log}
+}
+
+// add writes one member
+func (a *ZipWriter) add(info EntryInfo, r io.Reader) error {
+	debug(a.log, "adding", Field{"archive", a.fn}, Field{"member", info.Name})
+
+	hdr := &zip.FileHeader{Name: info.Name, Method: zip.Deflate, Modified: info.ModTime}
+	hdr.SetMode(info.Mode)
+
+	w, err := a.zw.CreateHeader(hdr)
+	if err != nil {
+		return addError(a.fn, info.Name, err)
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return addError(a.fn, info.Name, err)
+	}
+	return nil
+}
+
+// AddFile copies the file fn as name
+func (a *ZipWriter) AddFile(name, fn string) error {
+	return addFile(a.add, name, fn)
+}
+
+// AddBytes adds data as name
+func (a *ZipWriter) AddBytes(name string, data []byte) error {
+	return a.add(newEntry(name, int64(len(data))), bytes.NewReader(data))
+}
+
+// AddReader copies r as name, the size is not needed
+func (a *ZipWriter) AddReader(name string, r io.Reader, size int64) error {
+	return a.add(newEntry(name, size), r)
+}
+
+// Close writes the central directory
+func (a *ZipWriter) Close() error {
+	err := a.zw.Close()
+	if a.fh != nil {
+		if cerr := a.fh.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return errors.Wrap(err, "close")
+}
+
+// Type returns the archive type obviously.
+func (a *ZipWriter) Type() int {
+	return ArchiveZip
+}
+
+// ------------------- Tar
+
+// TarWriter creates tar files, compressed ones (.tar.gz, .tar.zst, etc.) too
+type TarWriter struct {
+	fn  string
+	typ int
+	tw  *tar.Writer
+	zfh io.WriteCloser
+	fh  io.Closer
+	mem int64
+	log Logger
+}
+
+// add writes one member, the size must be known
+func (a *TarWriter) add(info EntryInfo, r io.Reader) error {
+	debug(a.log, "adding", Field{"archive", a.fn}, Field{"member", info.Name})
+
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     info.Name,
+		Size:     info.Size,
+		Mode:     int64(info.Mode.Perm()),
+		ModTime:  info.ModTime,
+	}
+	if err := a.tw.WriteHeader(hdr); err != nil {
+		return addError(a.fn, info.Name, err)
+	}
+	n, err := io.Copy(a.tw, r)
+	if err != nil {
+		return addError(a.fn, info.Name, err)
+	}
+	if n != info.Size {
+		return addError(a.fn, info.Name, io.ErrUnexpectedEOF)
+	}
+	return nil
+}
+
+// AddFile copies the file fn as name
+func (a *TarWriter) AddFile(name, fn string) error {
+	return addFile(a.add, name, fn)
+}
+
+// AddBytes adds data as name
+func (a *TarWriter) AddBytes(name string, data []byte) error {
+	return a.add(newEntry(name, int64(len(data))), bytes.NewReader(data))
+}
+
+// AddReader copies r as name.  The header has the size so r is read first
+// when it is -1, in memory or in a temporary file like NewZipFromReader().
+func (a *TarWriter) AddReader(name string, r io.Reader, size int64) error {
+	if size >= 0 {
+		return a.add(newEntry(name, size), r)
+	}
+
+	ra, size, tmp, err := spool(r, "archive-*.tmp", a.mem, a.log)
+	if err != nil {
+		return addError(a.fn, name, err)
+	}
+	defer unspool(tmp)
+
+	return a.add(newEntry(name, size), io.NewSectionReader(ra, 0, size))
+}
+
+// Close writes the end of the archive and flushes the compression
+func (a *TarWriter) Close() error {
+	err := a.tw.Close()
+	if a.zfh != nil {
+		if cerr := a.zfh.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if a.fh != nil {
+		if cerr := a.fh.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return errors.Wrap(err, "close")
+}
+
+// Type returns the archive type obviously, with the compression bit if any.
+func (a *TarWriter) Type() int {
+	return ArchiveTar | a.typ
+}
+
+// ------------------- Single-stream compression
+
+// StreamWriter creates gzip, zstd, xz, etc. files, these have only one
+// member.  The name goes into the header for gzip and is ignored otherwise.
+type StreamWriter struct {
+	fn   string
+	typ  int
+	zfh  io.WriteCloser
+	fh   io.Closer
+	done bool
+	log  Logger
+}
+
+// add compresses r, only once
+func (a *StreamWriter) add(info EntryInfo, r io.Reader) error {
+	debug(a.log, "adding", Field{"archive", a.fn}, Field{"member", info.Name})
+
+	if a.done {
+		return addError(a.fn, info.Name, errors.Wrap(ErrUnsupported, "only one file per stream"))
+	}
+	a.done = true
+
+	if gw, ok := a.zfh.(*gzip.Writer); ok {
+		gw.Name, gw.ModTime = info.Name, info.ModTime
+	}
+	if _, err := io.Copy(a.zfh, r); err != nil {
+		return addError(a.fn, info.Name, err)
+	}
+	return nil
+}
+
+// AddFile compresses the file fn
+func (a *StreamWriter) AddFile(name, fn string) error {
+	return addFile(a.add, name, fn)
+}
+
+// AddBytes compresses data
+func (a *StreamWriter) AddBytes(name string, data []byte) error {
+	return a.add(newEntry(name, int64(len(data))), bytes.NewReader(data))
+}
+
+// AddReader compresses r, the size is not needed
+func (a *StreamWriter) AddReader(name string, r io.Reader, size int64) error {
+	return a.add(newEntry(name, size), r)
+}
+
+// Close flushes the compression
+func (a *StreamWriter) Close() error {
+	err := a.zfh.Close()
+	if a.fh != nil {
+		if cerr := a.fh.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return errors.Wrap(err, "close")
+}
+
+// Type returns the archive type obviously.
+func (a *StreamWriter) Type() int {
+	return a.typ
+}
@@ -0,0 +1,299 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreate(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	td := []struct {
+		fn  string
+		typ int
+	}{
+		{"test.zip", ArchiveZip},
+		{"test.tar", ArchiveTar},
+		{"test.tar.gz", ArchiveTar | ArchiveGzip},
+		{"test.tgz", ArchiveTar | ArchiveGzip},
+		{"test.tar.zst", ArchiveTar | ArchiveZstd},
+		{"test.tar.xz", ArchiveTar | ArchiveXz},
+		{"test.tar.lz4", ArchiveTar | ArchiveLz4},
+	}
+
+	for _, d := range td {
+		fn := filepath.Join(dir, d.fn)
+
+		w, err := Create(fn, 0)
+		require.NoError(t, err, d.fn)
+		assert.Equal(t, d.typ, w.Type(), d.fn)
+
+		require.NoError(t, w.AddBytes("notempty.txt", []byte("this is a file\n")))
+		require.NoError(t, w.AddFile("sub/data.xml", "testdata/notempty.txt"))
+		require.NoError(t, w.AddReader("other.txt", strings.NewReader("another file\n"), -1))
+		require.NoError(t, w.Close())
+
+		a, err := New(fn)
+		require.NoError(t, err, d.fn)
+		assert.Equal(t, d.typ, a.Type(), d.fn)
+
+		all, err := a.(MultiExtracter).ExtractAll("")
+		require.NoError(t, err, d.fn)
+		assert.Equal(t, []Member{
+			{Name: "notempty.txt", Data: []byte("this is a file\n")},
+			{Name: "sub/data.xml", Data: []byte("this is a file\n")},
+			{Name: "other.txt", Data: []byte("another file\n")},
+		}, all, d.fn)
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestCreate_Stream(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	td := []struct {
+		fn  string
+		typ int
+	}{
+		{"test.txt.gz", ArchiveGzip},
+		{"test.txt.zst", ArchiveZstd},
+		{"test.txt.xz", ArchiveXz},
+		{"test.txt.lz4", ArchiveLz4},
+		{"test.txt.zlib", ArchiveZlib},
+		{"test.txt.deflate", ArchiveDeflate},
+	}
+
+	for _, d := range td {
+		fn := filepath.Join(dir, d.fn)
+
+		w, err := Create(fn, 0)
+		require.NoError(t, err, d.fn)
+		assert.Equal(t, d.typ, w.Type(), d.fn)
+
+		require.NoError(t, w.AddFile("notempty.txt", "testdata/notempty.txt"))
+
+		err = w.AddBytes("other.txt", []byte("another file\n"))
+		assert.True(t, errors.Is(err, ErrUnsupported), "only one file")
+		require.NoError(t, w.Close())
+
+		a, err := New(fn)
+		require.NoError(t, err, d.fn)
+		assert.Equal(t, d.typ, a.Type(), d.fn)
+
+		txt, err := a.Extract("")
+		require.NoError(t, err, d.fn)
+		assert.Equal(t, "this is a file\n", string(txt), d.fn)
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestCreate_GzipHeader(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, ArchiveGzip)
+	require.NoError(t, err)
+	require.NoError(t, w.AddFile("notempty.txt", "testdata/notempty.txt"))
+	require.NoError(t, w.Close())
+
+	fi, err := os.Stat("testdata/notempty.txt")
+	require.NoError(t, err)
+
+	zfh, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "notempty.txt", zfh.Name)
+	assert.Equal(t, fi.ModTime().Unix(), zfh.ModTime.Unix())
+}
+
+func TestCreate_Attributes(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "script.sh")
+	require.NoError(t, ioutil.WriteFile(src, []byte("#! /bin/sh\n"), 0755))
+	mtime := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(src, mtime, mtime))
+
+	for _, fn := range []string{"attr.zip", "attr.tar.gz"} {
+		fn = filepath.Join(dir, fn)
+
+		w, err := Create(fn, 0)
+		require.NoError(t, err)
+		require.NoError(t, w.AddFile("bin/script.sh", src))
+		require.NoError(t, w.Close())
+
+		a, err := New(fn)
+		require.NoError(t, err)
+
+		list, err := a.(Lister).List()
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, "bin/script.sh", list[0].Name)
+		assert.Equal(t, int64(11), list[0].Size)
+		assert.Equal(t, os.FileMode(0755), list[0].Mode.Perm(), fn)
+		assert.True(t, mtime.Equal(list[0].ModTime), fn)
+		require.NoError(t, a.Close())
+	}
+}
+
+func TestCreate_Level(t *testing.T) {
+	data := bytes.Repeat([]byte("all work and no play makes jack a dull boy\n"), 1000)
+
+	for _, typ := range []int{ArchiveZip, ArchiveTar | ArchiveGzip, ArchiveZstd, ArchiveLz4} {
+		var fast, best bytes.Buffer
+
+		w, err := NewWriter(&fast, typ, WithLevel(1))
+		require.NoError(t, err)
+		require.NoError(t, w.AddBytes("jack.txt", data))
+		require.NoError(t, w.Close())
+
+		w, err = NewWriter(&best, typ, WithLevel(9))
+		require.NoError(t, err)
+		require.NoError(t, w.AddBytes("jack.txt", data))
+		require.NoError(t, w.Close())
+
+		assert.True(t, best.Len() <= fast.Len(), "type %d: %d > %d", typ, best.Len(), fast.Len())
+
+		a, err := NewFromReader(&best, typ)
+		require.NoError(t, err)
+		content, err := a.Extract(".txt")
+		require.NoError(t, err, "type %d", typ)
+		assert.Equal(t, data, content)
+	}
+}
+
+func TestLz4_BadLevel(t *testing.T) {
+	f, ok := lookupFormat(ArchiveLz4)
+	require.True(t, ok)
+
+	for _, level := range []int{-1, 10} {
+		_, err := f.Compress(ioutil.Discard, level)
+		assert.Error(t, err, "level %d", level)
+	}
+}
+
+func TestCreate_DefaultLevel(t *testing.T) {
+	data := bytes.Repeat([]byte("all work and no play makes jack a dull boy\n"), 1000)
+
+	for _, d := range []struct{ typ, level int }{{ArchiveZlib, 6}, {ArchiveDeflate, 6}} {
+		var none, zero, def bytes.Buffer
+
+		for _, c := range []struct {
+			buf  *bytes.Buffer
+			opts []Option
+		}{{&none, nil}, {&zero, []Option{WithLevel(0)}}, {&def, []Option{WithLevel(d.level)}}} {
+			w, err := NewWriter(c.buf, d.typ, c.opts...)
+			require.NoError(t, err)
+			require.NoError(t, w.AddBytes("", data))
+			require.NoError(t, w.Close())
+		}
+		assert.Equal(t, def.Bytes(), none.Bytes(), "type %d", d.typ)
+		assert.Equal(t, def.Bytes(), zero.Bytes(), "type %d", d.typ)
+	}
+}
+
+func TestCreate_Bad(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	// Nothing is overwritten if we can not write the type
+	fn := filepath.Join(dir, "keep.7z")
+	require.NoError(t, ioutil.WriteFile(fn, []byte("keep"), 0644))
+
+	_, err := Create(fn, 0)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+
+	content, err := ioutil.ReadFile(fn)
+	require.NoError(t, err)
+	assert.Equal(t, "keep", string(content))
+
+	_, err = Create(filepath.Join(dir, "test.txt"), 0)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+
+	_, err = Create(filepath.Join(dir, "test.tar.bz2"), 0)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+
+	_, err = Create(filepath.Join(dir, "test.zip"), 0, WithLevel(10))
+	assert.Error(t, err)
+
+	_, err = Create("/nonexistent/test.zip", 0)
+	assert.Error(t, err)
+
+	_, err = NewWriter(nil, ArchiveZip)
+	assert.True(t, errors.Is(err, ErrNilWriter))
+
+	_, err = NewWriter(&bytes.Buffer{}, 0)
+	assert.True(t, errors.Is(err, ErrUnsupported))
+
+	w, err := Create(filepath.Join(dir, "test.zip"), 0)
+	require.NoError(t, err)
+	defer w.Close()
+
+	assert.Error(t, w.AddFile("dir", dir))
+	assert.Error(t, w.AddFile("nothing", "/nonexistent"))
+}
+
+func TestCreate_WithType(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	fn := filepath.Join(dir, "report")
+
+	w, err := Create(fn, 0, WithType(ArchiveTar|ArchiveZstd))
+	require.NoError(t, err)
+	require.NoError(t, w.AddBytes("report.csv", []byte("a,b\n")))
+	require.NoError(t, w.Close())
+
+	a, err := New(fn, WithType(ArchiveTar|ArchiveZstd))
+	require.NoError(t, err)
+	defer a.Close()
+
+	csv, err := a.Extract(".csv")
+	require.NoError(t, err)
+	assert.Equal(t, "a,b\n", string(csv))
+}
+
+func TestTarWriter_AddReader(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, ArchiveTar)
+	require.NoError(t, err)
+
+	err = w.AddReader("short.txt", strings.NewReader("abc"), 10)
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+
+	w, err = NewWriter(&buf, ArchiveTar)
+	require.NoError(t, err)
+
+	var ae *ArchiveError
+	err = w.AddReader("long.txt", strings.NewReader("abcdef"), 3)
+	require.True(t, errors.As(err, &ae))
+	assert.Equal(t, "long.txt", ae.Member)
+}
+
+func TestTarWriter_AddReaderSpill(t *testing.T) {
+	var buf bytes.Buffer
+
+	w, err := NewWriter(&buf, ArchiveTar, WithMemoryLimit(16))
+	require.NoError(t, err)
+	require.NoError(t, w.AddReader("big.txt", strings.NewReader(strings.Repeat("x", 100)), -1))
+	require.NoError(t, w.Close())
+
+	a, err := NewFromReader(&buf, ArchiveTar)
+	require.NoError(t, err)
+	txt, err := a.Extract(".txt")
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", 100), string(txt))
+}